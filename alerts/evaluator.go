@@ -0,0 +1,209 @@
+package alerts
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/kubernetes"
+	"github.com/kapetacom/insight-api/logging"
+)
+
+// RuleStatus is a rule together with the result of its last evaluation
+type RuleStatus struct {
+	Rule          *Rule `json:"rule"`
+	Firing        bool  `json:"firing"`
+	Count         int   `json:"count"`
+	LastEvaluated int64 `json:"lastEvaluated,omitempty"`
+	LastFired     int64 `json:"lastFired,omitempty"`
+	// Truncated is true when the window held more log than the evaluation limits,
+	// the count is then a lower bound
+	Truncated bool   `json:"truncated"`
+	Error     string `json:"error,omitempty"`
+}
+
+const (
+	defaultEvaluationMaxLines = 100000
+	defaultEvaluationMaxBytes = 50 * 1024 * 1024
+)
+
+// evaluationLimits are the limits of the log read for a rule, configured through ALERT_MAX_LINES
+// and ALERT_MAX_BYTES. They are larger than the limits of a request, as a rule has to count the
+// lines while the log is flooding, and only keep the most recent lines of the window.
+func evaluationLimits() logging.LogLimits {
+	limits := logging.LogLimits{MaxLines: defaultEvaluationMaxLines, MaxBytes: defaultEvaluationMaxBytes}
+	if v, err := strconv.Atoi(os.Getenv("ALERT_MAX_LINES")); err == nil && v > 0 {
+		limits.MaxLines = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("ALERT_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		limits.MaxBytes = v
+	}
+	// one line more than the budget, so a window with more lines is reported as truncated
+	limits.TailLines = int64(limits.MaxLines) + 1
+	return limits
+}
+
+// Evaluator periodically evaluates the alert rules against the log backend
+type Evaluator struct {
+	mode     string
+	source   logging.Source
+	interval time.Duration
+
+	mu       sync.RWMutex
+	statuses map[string]*RuleStatus
+	order    []string
+	loadErr  string
+}
+
+func NewEvaluator(mode string, interval time.Duration) *Evaluator {
+	return &Evaluator{
+		mode:     mode,
+		source:   logging.NewSource(mode),
+		interval: interval,
+		statuses: map[string]*RuleStatus{},
+	}
+}
+
+// Start evaluates the rules every interval until the context is cancelled
+func (e *Evaluator) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			e.evaluate(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Rules returns the rules and their current status
+func (e *Evaluator) Rules() ([]RuleStatus, string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	result := []RuleStatus{}
+	for _, name := range e.order {
+		result = append(result, *e.statuses[name])
+	}
+	return result, e.loadErr
+}
+
+func (e *Evaluator) evaluate(ctx context.Context) {
+	clientset, err := kubernetes.KubernetesClient()
+	if err != nil {
+		e.setLoadError(err)
+		return
+	}
+	rules, err := LoadRules(ctx, clientset)
+	if err != nil {
+		e.setLoadError(err)
+		return
+	}
+	e.sync(rules)
+
+	deployment := ""
+	if e.mode != "kubernetes-only" && len(rules) > 0 {
+		d, err := kubernetes.GetDeployment(ctx)
+		if err != nil {
+			e.setLoadError(err)
+			return
+		}
+		deployment = logging.DeploymentLabel(d.Metadata.Name)
+	}
+
+	for _, rule := range rules {
+		e.evaluateRule(ctx, rule, deployment)
+	}
+}
+
+// sync replaces the rules while keeping the state of rules that are unchanged
+func (e *Evaluator) sync(rules []*Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loadErr = ""
+	statuses := map[string]*RuleStatus{}
+	order := []string{}
+	for _, rule := range rules {
+		status, ok := e.statuses[rule.Name]
+		if !ok || !status.Rule.sameAs(rule) {
+			status = &RuleStatus{}
+		}
+		status.Rule = rule
+		statuses[rule.Name] = status
+		order = append(order, rule.Name)
+	}
+	e.statuses = statuses
+	e.order = order
+}
+
+func (e *Evaluator) setLoadError(err error) {
+	log.Printf("error loading alert rules: %v\n", err)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loadErr = err.Error()
+}
+
+func (e *Evaluator) evaluateRule(ctx context.Context, rule *Rule, deployment string) {
+	now := time.Now()
+	entries, truncated, err := e.source.Entries(ctx, logging.Query{
+		Instance:   rule.Instance,
+		Deployment: deployment,
+		Since:      now.Add(-rule.window),
+		Until:      now,
+		Limits:     evaluationLimits(),
+	})
+
+	e.mu.Lock()
+	status := e.statuses[rule.Name]
+	status.LastEvaluated = now.UnixMilli()
+	if err != nil {
+		status.Error = err.Error()
+		e.mu.Unlock()
+		log.Printf("error evaluating alert rule %v: %v\n", rule.Name, err)
+		return
+	}
+	status.Error = ""
+
+	count := 0
+	var example *logging.LogEntry
+	for _, entry := range entries {
+		if rule.Matches(entry) {
+			count++
+			example = entry
+		}
+	}
+	status.Count = count
+	status.Truncated = truncated
+	wasFiring := status.Firing
+	// a truncated window has at least as many matches, so it fires as soon as the count is over
+	status.Firing = count > rule.Threshold
+	if !status.Firing || wasFiring {
+		e.mu.Unlock()
+		return
+	}
+	// only notify when the rule starts firing, not on every evaluation while it keeps firing
+	status.LastFired = now.UnixMilli()
+	e.mu.Unlock()
+
+	err = Notify(ctx, rule, &Notification{
+		Rule:      rule.Name,
+		Instance:  rule.Instance,
+		Count:     count,
+		Threshold: rule.Threshold,
+		Window:    rule.Window,
+		FiredAt:   now.UnixMilli(),
+		Example:   example,
+	})
+	if err != nil {
+		log.Printf("error notifying webhook for alert rule %v: %v\n", rule.Name, err)
+		e.mu.Lock()
+		status.Error = err.Error()
+		e.mu.Unlock()
+	}
+}
@@ -0,0 +1,46 @@
+package alerts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kapetacom/insight-api/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSource struct {
+	entries   []*logging.LogEntry
+	truncated bool
+	query     logging.Query
+}
+
+func (s *testSource) Entries(ctx context.Context, q logging.Query) ([]*logging.LogEntry, bool, error) {
+	s.query = q
+	return s.entries, s.truncated, nil
+}
+
+func TestEvaluateRule(t *testing.T) {
+	notified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified++
+	}))
+	defer server.Close()
+
+	t.Setenv("ALERT_MAX_LINES", "2")
+	rules, err := ParseRules([]byte(`[{"name": "errors", "severity": "error", "threshold": 1, "window": "5m", "webhook": "` + server.URL + `"}]`))
+	assert.NoError(t, err)
+	source := &testSource{entries: []*logging.LogEntry{{Severity: "ERROR"}, {Severity: "ERROR"}}, truncated: true}
+	e := &Evaluator{source: source, statuses: map[string]*RuleStatus{}}
+	e.sync(rules)
+
+	e.evaluateRule(context.Background(), rules[0], "")
+	statuses, _ := e.Rules()
+	assert.Equal(t, 2, source.query.Limits.MaxLines)
+	assert.Equal(t, int64(3), source.query.Limits.TailLines)
+	assert.True(t, statuses[0].Truncated)
+	assert.True(t, statuses[0].Firing)
+	assert.Equal(t, 2, statuses[0].Count)
+	assert.Equal(t, 1, notified)
+}
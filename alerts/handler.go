@@ -0,0 +1,42 @@
+package alerts
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/labstack/echo/v4"
+)
+
+type rulesResponse struct {
+	Rules []RuleStatus `json:"rules"`
+	Error string       `json:"error,omitempty"`
+}
+
+// ListRules returns the configured alert rules and whether they are currently firing
+func ListRules(evaluator *Evaluator) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.LOGGING_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.LOGGING_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		rules, loadErr := evaluator.Rules()
+		for i := range rules {
+			// webhook urls usually carry a secret so only the host is returned
+			rule := *rules[i].Rule
+			rule.Webhook = redactWebhook(rule.Webhook)
+			rules[i].Rule = &rule
+		}
+		return c.JSON(http.StatusOK, rulesResponse{Rules: rules, Error: loadErr})
+	}
+}
+
+func redactWebhook(webhook string) string {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "redacted"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
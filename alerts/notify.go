@@ -0,0 +1,72 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kapetacom/insight-api/logging"
+)
+
+// Notification is the generic webhook payload sent when a rule fires
+type Notification struct {
+	Rule      string            `json:"rule"`
+	Instance  string            `json:"instance,omitempty"`
+	Count     int               `json:"count"`
+	Threshold int               `json:"threshold"`
+	Window    string            `json:"window"`
+	FiredAt   int64             `json:"firedAt"`
+	Example   *logging.LogEntry `json:"example,omitempty"`
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (n *Notification) text() string {
+	instance := n.Instance
+	if instance == "" {
+		instance = "all instances"
+	}
+	text := fmt.Sprintf(":rotating_light: Alert *%v* fired for %v: %d matching log entries in the last %v (threshold %d)",
+		n.Rule, instance, n.Count, n.Window, n.Threshold)
+	if n.Example != nil {
+		text += fmt.Sprintf("\n```%v```", n.Example.Message)
+	}
+	return text
+}
+
+// payload returns the webhook body in the format of the rule
+func (n *Notification) payload(format string) ([]byte, error) {
+	if format == "slack" {
+		return json.Marshal(slackMessage{Text: n.text()})
+	}
+	return json.Marshal(n)
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notify posts the notification to the webhook of the rule
+func Notify(ctx context.Context, rule *Rule, n *Notification) error {
+	body, err := n.payload(rule.Format)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %v", resp.Status)
+	}
+	return nil
+}
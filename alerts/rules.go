@@ -0,0 +1,124 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/kapetacom/insight-api/logging"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	RulesNamespace = "kapeta"
+	RulesConfigMap = "insight-alert-rules"
+	RulesKey       = "rules.json"
+)
+
+// Rule is a log pattern alert, it fires when more than Threshold entries
+// matching Severity and Pattern are logged by Instance within Window
+type Rule struct {
+	Name string `json:"name"`
+	// Instance is the block id to watch, empty means all blocks
+	Instance string `json:"instance,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	// Pattern is a regular expression matched against the message
+	Pattern   string `json:"pattern,omitempty"`
+	Threshold int    `json:"threshold"`
+	Window    string `json:"window"`
+	Webhook   string `json:"webhook"`
+	// Format of the webhook payload, either "slack" or "generic"
+	Format string `json:"format,omitempty"`
+
+	window  time.Duration
+	pattern *regexp.Regexp
+}
+
+// Matches returns true if the entry counts towards the rule
+func (r *Rule) Matches(entry *logging.LogEntry) bool {
+	if r.Severity != "" && !entry.HasSeverity(r.Severity) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(entry.Message) {
+		return false
+	}
+	return true
+}
+
+// sameAs returns true if both rules have the same configuration
+func (r *Rule) sameAs(other *Rule) bool {
+	return r.Name == other.Name && r.Instance == other.Instance && r.Severity == other.Severity &&
+		r.Pattern == other.Pattern && r.Threshold == other.Threshold && r.Window == other.Window &&
+		r.Webhook == other.Webhook && r.Format == other.Format
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule is missing a name")
+	}
+	if r.Webhook == "" {
+		return fmt.Errorf("rule %v is missing a webhook", r.Name)
+	}
+	switch r.Format {
+	case "":
+		r.Format = "generic"
+	case "slack", "generic":
+	default:
+		return fmt.Errorf("rule %v has unknown format %q", r.Name, r.Format)
+	}
+	if r.Threshold < 0 {
+		return fmt.Errorf("rule %v has a negative threshold", r.Name)
+	}
+	window, err := time.ParseDuration(r.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("rule %v has invalid window %q", r.Name, r.Window)
+	}
+	r.window = window
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %v has invalid pattern: %v", r.Name, err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
+
+// ParseRules decodes and validates a list of rules
+func ParseRules(data []byte) ([]*Rule, error) {
+	rules := []*Rule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error decoding alert rules: %v", err)
+	}
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule name %v", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return rules, nil
+}
+
+// LoadRules reads the rules from the alert rules ConfigMap, a missing ConfigMap means no rules
+func LoadRules(ctx context.Context, clientset kubernetes.Interface) ([]*Rule, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(RulesNamespace).Get(ctx, RulesConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return []*Rule{}, nil
+		}
+		return nil, fmt.Errorf("error getting alert rules: %v", err)
+	}
+	data, ok := cm.Data[RulesKey]
+	if !ok {
+		return []*Rule{}, nil
+	}
+	return ParseRules([]byte(data))
+}
@@ -0,0 +1,65 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kapetacom/insight-api/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	t.Run("should parse and match rules", func(t *testing.T) {
+		rules, err := ParseRules([]byte(`[
+			{"name": "errors", "instance": "block-1", "severity": "error", "threshold": 20, "window": "5m", "webhook": "http://example.com/hook"},
+			{"name": "oom", "pattern": "OutOfMemory", "window": "1m", "webhook": "http://example.com/hook", "format": "slack"}
+		]`))
+		assert.NoError(t, err)
+		assert.Len(t, rules, 2)
+		assert.Equal(t, "generic", rules[0].Format)
+
+		assert.True(t, rules[0].Matches(&logging.LogEntry{Severity: "ERROR", Message: "boom"}))
+		assert.True(t, rules[0].Matches(&logging.LogEntry{Severity: "INFO", Message: "[error] boom"}))
+		assert.False(t, rules[0].Matches(&logging.LogEntry{Severity: "INFO", Message: "all good"}))
+
+		assert.True(t, rules[1].Matches(&logging.LogEntry{Message: "java.lang.OutOfMemoryError"}))
+		assert.False(t, rules[1].Matches(&logging.LogEntry{Message: "started"}))
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		_, err := ParseRules([]byte(`[{"name": "a", "window": "forever", "webhook": "http://example.com"}]`))
+		assert.Error(t, err)
+		_, err = ParseRules([]byte(`[{"name": "a", "window": "1m", "webhook": "http://example.com", "pattern": "("}]`))
+		assert.Error(t, err)
+		_, err = ParseRules([]byte(`[{"name": "a", "window": "1m", "webhook": "http://example.com", "format": "teams"}]`))
+		assert.Error(t, err)
+		_, err = ParseRules([]byte(`[{"name": "a", "window": "1m", "webhook": "http://example.com"}, {"name": "a", "window": "1m", "webhook": "http://example.com"}]`))
+		assert.Error(t, err)
+	})
+}
+
+func TestNotify(t *testing.T) {
+	var received map[string]interface{}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer svr.Close()
+
+	n := &Notification{Rule: "oom", Count: 3, Window: "1m", Example: &logging.LogEntry{Message: "OutOfMemory"}}
+
+	err := Notify(context.Background(), &Rule{Webhook: svr.URL, Format: "slack"}, n)
+	assert.NoError(t, err)
+	assert.Contains(t, received["text"], "*oom*")
+	assert.Contains(t, received["text"], "OutOfMemory")
+
+	err = Notify(context.Background(), &Rule{Webhook: svr.URL, Format: "generic"}, n)
+	assert.NoError(t, err)
+	assert.Equal(t, "oom", received["rule"])
+	assert.Equal(t, float64(3), received["count"])
+}
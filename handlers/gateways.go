@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/kapetacom/insight-api/status"
+	"github.com/labstack/echo/v4"
+)
+
+// GetGateways lists the Istio gateways of the cluster with their servers and the
+// certificates referenced by their credentialName, built from the informer cache
+func GetGateways(cache *status.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		gateways, err := cache.GatewayInfos()
+		if err != nil {
+			if errors.Is(err, status.ErrNotSynced) {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error getting gateways: %v", err))
+		}
+		return c.JSON(http.StatusOK, gateways)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kapetacom/insight-api/history"
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/model"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/labstack/echo/v4"
+)
+
+// GetStateTimeline returns the recorded state transitions, optionally narrowed down
+// to one instance or type and a time window given as unix milliseconds
+func GetStateTimeline(recorder *history.Recorder) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		filter := history.Filter{
+			Instance: c.QueryParam("instance"),
+			Type:     c.QueryParam("type"),
+		}
+		var err error
+		if filter.From, err = timeParam(c, "from"); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if filter.To, err = timeParam(c, "to"); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"retention":   recorder.Retention().String(),
+			"transitions": recorder.Timeline(filter),
+		})
+	}
+}
+
+func timeParam(c echo.Context, name string) (time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %v %q", name, v)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// the windows reported when no window or time range is requested
+var availabilityWindows = []string{"24h", "7d", "30d"}
+
+// GetAvailability returns the availability per instance and for the environment, either for
+// the given window, for the from and to range or for each of the last 24h, 7d and 30d
+func GetAvailability(recorder *history.Recorder) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		now := time.Now()
+		reports := []model.AvailabilityReport{}
+		if c.QueryParam("from") != "" {
+			from, err := timeParam(c, "from")
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			to, err := timeParam(c, "to")
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			if to.IsZero() {
+				to = now
+			}
+			if !from.Before(to) {
+				return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+			}
+			reports = append(reports, recorder.Availability(to.Sub(from).String(), from, to))
+		} else {
+			windows := availabilityWindows
+			if window := c.QueryParam("window"); window != "" {
+				windows = []string{window}
+			}
+			for _, window := range windows {
+				duration, err := parseWindow(window)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+				}
+				reports = append(reports, recorder.Availability(window, now.Add(-duration), now))
+			}
+		}
+
+		if instance := c.QueryParam("instance"); instance != "" {
+			for i := range reports {
+				instances := []model.Availability{}
+				for _, availability := range reports[i].Instances {
+					if availability.Name == instance || availability.ID == instance {
+						instances = append(instances, availability)
+					}
+				}
+				reports[i].Instances = instances
+			}
+		}
+		return c.JSON(http.StatusOK, reports)
+	}
+}
+
+// parseWindow parses a duration that may also be given in days, e.g. 7d
+func parseWindow(window string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(window, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid window %q", window)
+	}
+	return duration, nil
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/kubernetes"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/kapetacom/insight-api/status"
+	"github.com/labstack/echo/v4"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetInstancePods returns the state of every pod of an instance
+func GetInstancePods(c echo.Context) error {
+	if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+	}
+	instanceId := c.Param("instance")
+	namespace := "services"
+	if c.QueryParam("namespace") != "" {
+		namespace = c.QueryParam("namespace")
+	}
+	ctx := c.Request().Context()
+
+	clientset, err := kubernetes.KubernetesClient()
+	if err != nil {
+		return fmt.Errorf("error getting kubernetes client: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "kapeta.com/block-id=" + instanceId,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting pods: %v", err)
+	}
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,reason=Unhealthy",
+	})
+	if err != nil {
+		return fmt.Errorf("error getting events: %v", err)
+	}
+
+	items := []*corev1.Pod{}
+	for i := range pods.Items {
+		items = append(items, &pods.Items[i])
+	}
+	return c.JSON(http.StatusOK, status.PodStates(items, events.Items))
+}
+
+// GetInstanceResources returns the cpu and memory usage of the pods of an instance compared to their
+// requests and limits, usage is only reported when metrics-server is installed
+func GetInstanceResources(cache *status.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		resources, err := cache.InstanceResources(c.Param("instance"))
+		if err != nil {
+			if errors.Is(err, status.ErrNotSynced) {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, resources)
+	}
+}
+
+// GetInstanceHealth returns the last call to the health endpoint of an instance
+func GetInstanceHealth(cache *status.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		check, err := cache.InstanceHealth(c.Param("instance"))
+		if err != nil {
+			if errors.Is(err, status.ErrNotSynced) {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			}
+			if errors.Is(err, status.ErrHealthNotChecked) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, check)
+	}
+}
+
+// GetInstanceAutoscaler returns the autoscaler of an instance with the current values of its metrics
+func GetInstanceAutoscaler(cache *status.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		autoscaler, err := cache.InstanceAutoscaler(c.Param("instance"))
+		if err != nil {
+			if errors.Is(err, status.ErrNotSynced) {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			}
+			if errors.Is(err, status.ErrAutoscalerNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, autoscaler)
+	}
+}
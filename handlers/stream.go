@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/kapetacom/insight-api/status"
+	"github.com/labstack/echo/v4"
+)
+
+const heartbeatInterval = 30 * time.Second
+
+// WatchEnvironmentStatus streams the status as server-sent events, the full status is sent
+// first followed by instance and operator changes. Clients reconnecting with the
+// Last-Event-ID header resume where they left off.
+func WatchEnvironmentStatus(broadcaster *status.Broadcaster) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		lastEventID := c.Request().Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = c.QueryParam("lastEventId")
+		}
+		initial, events, cancel := broadcaster.Subscribe(lastEventID)
+		defer cancel()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		res.WriteHeader(http.StatusOK)
+
+		for _, event := range initial {
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+					return nil
+				}
+			case event, ok := <-events:
+				if !ok {
+					// we fell behind, the client reconnects and resumes from the last event id
+					return nil
+				}
+				if err := writeEvent(res, event); err != nil {
+					return nil
+				}
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, event status.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// WatchRollout streams the rollout progress of the current environment version as server-sent
+// events, the progress is sent first and again whenever the status stream reports a change
+func WatchRollout(cache *status.Cache, broadcaster *status.Broadcaster) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !jwt.HasScopeForHandle(c, os.Getenv("KAPETA_HANDLE"), scopes.RUNTIME_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.RUNTIME_READ_SCOPE, os.Getenv("KAPETA_HANDLE")))
+		}
+		progress, err := cache.Rollout()
+		if err != nil {
+			switch {
+			case errors.Is(err, status.ErrNotSynced):
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			case errors.Is(err, status.ErrVersionNotFound):
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		// only used to be told about changes, the progress is read from the cache
+		_, changes, cancel := broadcaster.Subscribe("")
+		defer cancel()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		res.WriteHeader(http.StatusOK)
+
+		id := uint64(1)
+		if err := writeEvent(res, status.Event{ID: id, Type: status.EventRollout, Data: progress}); err != nil {
+			return nil
+		}
+		res.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+					return nil
+				}
+			case _, ok := <-changes:
+				if !ok {
+					return nil
+				}
+				next, err := cache.Rollout()
+				if err != nil || !status.RolloutChanged(progress, next) {
+					continue
+				}
+				progress = next
+				id++
+				if err := writeEvent(res, status.Event{ID: id, Type: status.EventRollout, Data: progress}); err != nil {
+					return nil
+				}
+			}
+			res.Flush()
+		}
+	}
+}
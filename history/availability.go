@@ -0,0 +1,172 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+)
+
+// how a state counts towards availability
+const (
+	excluded = iota
+	available
+	unavailable
+)
+
+type change struct {
+	at    int64
+	class int
+}
+
+// classify tells if a state counts as up or down, states that are intentional like scaled
+// to zero or that we know nothing about, like removed or unknown, don't count either way.
+// A job or cronjob waiting for its schedule isn't down, only a failed run is.
+func classify(kind string, state string) int {
+	if kind == model.TypeJob || kind == model.TypeCronJob {
+		if state == model.StateFailed {
+			return unavailable
+		}
+		if state == model.StatePending {
+			return excluded
+		}
+	}
+	switch state {
+	case model.StateReady, model.StateRunning, model.StateCompleted, model.StateProgressing:
+		return available
+	case model.StateDegraded, model.StateCrashLooping, model.StateImagePullError, model.StatePending, model.StateFailed:
+		return unavailable
+	}
+	return excluded
+}
+
+// Availability reports the availability of every instance and operator and of the environment
+// as a whole between from and to, the environment is down while any long running instance or
+// operator is unavailable, jobs and cronjobs only run now and then so they don't count for it
+func (r *Recorder) Availability(window string, from time.Time, to time.Time) model.AvailabilityReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report := model.AvailabilityReport{
+		Window:    window,
+		From:      from.UnixMilli(),
+		To:        to.UnixMilli(),
+		Instances: []model.Availability{},
+	}
+
+	series := map[string][]change{}
+	current := map[string]int{}
+	environment := []change{}
+	for _, t := range r.transitions {
+		key := transitionKey(t)
+		class := classify(t.Type, t.To)
+		series[key] = appendChange(series[key], change{at: t.Timestamp, class: class})
+		if t.Type == model.TypeJob || t.Type == model.TypeCronJob {
+			continue
+		}
+		current[key] = class
+		// a full status records many transitions at once, only the outcome counts for the environment
+		if n := len(environment); n > 0 && environment[n-1].at == t.Timestamp {
+			environment = environment[:n-1]
+		}
+		environment = appendChange(environment, change{at: t.Timestamp, class: environmentClass(current)})
+	}
+
+	report.Environment = measure(environment, report.From, report.To)
+	for key, changes := range series {
+		availability := measure(changes, report.From, report.To)
+		if availability.Measured == 0 && availability.Incidents == 0 {
+			continue
+		}
+		last := r.last[key]
+		availability.Type = last.Type
+		availability.Name = last.Name
+		availability.ID = last.ID
+		availability.Provider = last.Provider
+		report.Instances = append(report.Instances, availability)
+	}
+	sort.Slice(report.Instances, func(i, j int) bool {
+		if report.Instances[i].Type != report.Instances[j].Type {
+			return report.Instances[i].Type < report.Instances[j].Type
+		}
+		return report.Instances[i].Name < report.Instances[j].Name
+	})
+	return report
+}
+
+// appendChange only keeps changes between classes, e.g. crash looping after degraded is the same incident
+func appendChange(changes []change, c change) []change {
+	if len(changes) > 0 && changes[len(changes)-1].class == c.class {
+		return changes
+	}
+	return append(changes, c)
+}
+
+func environmentClass(current map[string]int) int {
+	class := excluded
+	for _, c := range current {
+		if c == unavailable {
+			return unavailable
+		}
+		if c == available {
+			class = available
+		}
+	}
+	return class
+}
+
+// measure adds up the time spent in each class between from and to, an incident is a period of
+// unavailability and counts towards the mean time to recovery once the instance is available again
+func measure(changes []change, from int64, to int64) model.Availability {
+	result := model.Availability{}
+	class := excluded
+	incidentStart := int64(0)
+	i := 0
+	// the state at the start of the window, an incident that is already going on counts as well
+	for ; i < len(changes) && changes[i].at <= from; i++ {
+		class = changes[i].class
+		incidentStart = changes[i].at
+	}
+	if class == unavailable {
+		result.Incidents++
+	}
+
+	recoveries := int64(0)
+	recovered := 0
+	segmentStart := from
+	for ; i < len(changes) && changes[i].at <= to; i++ {
+		next := changes[i]
+		addTime(&result, class, next.at-segmentStart)
+		if next.class == unavailable {
+			result.Incidents++
+			incidentStart = next.at
+		} else if class == unavailable && next.class == available {
+			recoveries += next.at - incidentStart
+			recovered++
+		}
+		class = next.class
+		segmentStart = next.at
+	}
+	addTime(&result, class, to-segmentStart)
+
+	result.Ongoing = class == unavailable
+	if recovered > 0 {
+		result.MTTR = recoveries / int64(recovered)
+	}
+	if result.Measured > 0 {
+		percentage := float64(result.Uptime) / float64(result.Measured) * 100
+		result.Percentage = &percentage
+	}
+	return result
+}
+
+func addTime(result *model.Availability, class int, duration int64) {
+	switch class {
+	case available:
+		result.Uptime += duration
+		result.Measured += duration
+	case unavailable:
+		result.Downtime += duration
+		result.Measured += duration
+	}
+}
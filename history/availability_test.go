@@ -0,0 +1,121 @@
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/kapetacom/insight-api/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name      string
+		changes   []change
+		uptime    int64
+		downtime  int64
+		incidents int
+		mttr      int64
+		ongoing   bool
+	}{
+		{
+			name:    "always available",
+			changes: []change{{at: 0, class: available}},
+			uptime:  100,
+		},
+		{
+			name:      "recovered incident",
+			changes:   []change{{at: 0, class: available}, {at: 20, class: unavailable}, {at: 30, class: available}},
+			uptime:    90,
+			downtime:  10,
+			incidents: 1,
+			mttr:      10,
+		},
+		{
+			name:      "incident started before the window",
+			changes:   []change{{at: -50, class: unavailable}, {at: 10, class: available}},
+			uptime:    90,
+			downtime:  10,
+			incidents: 1,
+			mttr:      60,
+		},
+		{
+			name:      "ongoing incident",
+			changes:   []change{{at: 0, class: available}, {at: 80, class: unavailable}},
+			uptime:    80,
+			downtime:  20,
+			incidents: 1,
+			ongoing:   true,
+		},
+		{
+			name:    "excluded time isn't measured",
+			changes: []change{{at: 0, class: excluded}, {at: 50, class: available}},
+			uptime:  50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := measure(tt.changes, 0, 100)
+			assert.Equal(t, tt.uptime, result.Uptime)
+			assert.Equal(t, tt.downtime, result.Downtime)
+			assert.Equal(t, tt.uptime+tt.downtime, result.Measured)
+			assert.Equal(t, tt.incidents, result.Incidents)
+			assert.Equal(t, tt.mttr, result.MTTR)
+			assert.Equal(t, tt.ongoing, result.Ongoing)
+		})
+	}
+}
+
+func TestRecorderAvailability(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	r := NewRecorder(nil, nil, 24*time.Hour, 100)
+	r.handle(status.Event{Type: status.EventStatus, Data: &model.ClusterStatus{
+		Instances: []model.InstanceState{
+			{Name: "todo", BlockID: "block-1", Type: model.TypeBlock, State: model.StateReady},
+			{Name: "users", BlockID: "block-2", Type: model.TypeBlock, State: model.StateReady},
+		},
+	}}, start)
+	for i, name := range []string{"todo", "users"} {
+		at := start.Add(time.Duration(10+20*i) * time.Minute)
+		r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+			Action:   status.ActionUpdated,
+			Instance: model.InstanceState{Name: name, BlockID: fmt.Sprintf("block-%d", i+1), Type: model.TypeBlock, State: model.StateCrashLooping},
+		}}, at)
+		r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+			Action:   status.ActionUpdated,
+			Instance: model.InstanceState{Name: name, BlockID: fmt.Sprintf("block-%d", i+1), Type: model.TypeBlock, State: model.StateReady},
+		}}, at.Add(5*time.Minute))
+	}
+
+	// a failed job is down on its own but doesn't take the environment down
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionUpdated,
+		Instance: model.InstanceState{Name: "migrate", BlockID: "block-1", Type: model.TypeJob, State: model.StateFailed},
+	}}, start.Add(45*time.Minute))
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionUpdated,
+		Instance: model.InstanceState{Name: "cleanup", BlockID: "block-2", Type: model.TypeCronJob, State: model.StatePending},
+	}}, start.Add(45*time.Minute))
+
+	report := r.Availability("1h", start, start.Add(time.Hour))
+	assert.Len(t, report.Instances, 3)
+	migrate := report.Instances[2]
+	assert.Equal(t, "migrate", migrate.Name)
+	assert.True(t, migrate.Ongoing)
+	todo := report.Instances[0]
+	assert.Equal(t, "todo", todo.Name)
+	assert.Equal(t, "block-1", todo.ID)
+	assert.Equal(t, 1, todo.Incidents)
+	assert.Equal(t, (5 * time.Minute).Milliseconds(), todo.MTTR)
+	assert.InDelta(t, 100*55.0/60.0, *todo.Percentage, 0.001)
+
+	assert.Equal(t, 2, report.Environment.Incidents)
+	assert.Equal(t, (10 * time.Minute).Milliseconds(), report.Environment.Downtime)
+
+	// nothing was recorded before the instances showed up
+	before := r.Availability("1h", start.Add(-time.Hour), start)
+	assert.Empty(t, before.Instances)
+	assert.Nil(t, before.Environment.Percentage)
+}
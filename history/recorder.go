@@ -0,0 +1,292 @@
+package history
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/kapetacom/insight-api/status"
+)
+
+const (
+	// StateRemoved is recorded when an instance or operator disappears from the status
+	StateRemoved = "Removed"
+	TypeOperator = "operator"
+
+	// transitions are written to the store at most this often
+	flushInterval = 10 * time.Second
+)
+
+// Filter selects the transitions returned by Timeline, zero values match everything
+type Filter struct {
+	// Instance matches the name or id of an instance or operator
+	Instance string
+	Type     string
+	From     time.Time
+	To       time.Time
+}
+
+// Recorder follows the status stream and keeps the state transitions of instances,
+// gateways and operators, older transitions are dropped once they are past the retention
+// or the history holds more than maxEntries, the last known state of each is always kept
+type Recorder struct {
+	broadcaster *status.Broadcaster
+	store       Store
+	retention   time.Duration
+	maxEntries  int
+
+	mu          sync.RWMutex
+	transitions []model.StateTransition
+	last        map[string]model.StateTransition
+	dirty       bool
+}
+
+func NewRecorder(broadcaster *status.Broadcaster, store Store, retention time.Duration, maxEntries int) *Recorder {
+	return &Recorder{
+		broadcaster: broadcaster,
+		store:       store,
+		retention:   retention,
+		maxEntries:  maxEntries,
+		transitions: []model.StateTransition{},
+		last:        map[string]model.StateTransition{},
+	}
+}
+
+// Start loads the stored history and records transitions until the context is cancelled
+func (r *Recorder) Start(ctx context.Context) {
+	transitions, err := r.store.Load(ctx)
+	if err != nil {
+		log.Printf("error loading state history: %v\n", err)
+	} else {
+		r.restore(transitions)
+	}
+
+	go r.follow(ctx)
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// write what's left with a context of its own as ours is already cancelled
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				r.flush(flushCtx)
+				cancel()
+				return
+			case <-ticker.C:
+				r.flush(ctx)
+			}
+		}
+	}()
+}
+
+// follow subscribes to the status stream, resubscribing if it was dropped for falling behind
+func (r *Recorder) follow(ctx context.Context) {
+	lastEventID := ""
+	for {
+		initial, events, cancel := r.broadcaster.Subscribe(lastEventID)
+		for _, event := range initial {
+			r.handle(event, time.Now())
+			lastEventID = strconv.FormatUint(event.ID, 10)
+		}
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case event, ok := <-events:
+				if !ok {
+					break loop
+				}
+				r.handle(event, time.Now())
+				lastEventID = strconv.FormatUint(event.ID, 10)
+			}
+		}
+		cancel()
+	}
+}
+
+// Timeline returns the recorded transitions matching the filter, oldest first
+func (r *Recorder) Timeline(filter Filter) []model.StateTransition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := []model.StateTransition{}
+	for _, t := range r.transitions {
+		if filter.Instance != "" && t.Name != filter.Instance && t.ID != filter.Instance {
+			continue
+		}
+		if filter.Type != "" && t.Type != filter.Type {
+			continue
+		}
+		if !filter.From.IsZero() && t.Timestamp < filter.From.UnixMilli() {
+			continue
+		}
+		if !filter.To.IsZero() && t.Timestamp > filter.To.UnixMilli() {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// Retention returns how long transitions are kept
+func (r *Recorder) Retention() time.Duration {
+	return r.retention
+}
+
+// restore continues from the stored history, so a restart doesn't record every
+// instance again unless its state changed while we were gone
+func (r *Recorder) restore(transitions []model.StateTransition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].Timestamp < transitions[j].Timestamp
+	})
+	r.transitions = transitions
+	for _, t := range transitions {
+		r.last[transitionKey(t)] = t
+	}
+	r.trim(time.Now())
+}
+
+func (r *Recorder) handle(event status.Event, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch data := event.Data.(type) {
+	case *model.ClusterStatus:
+		seen := map[string]bool{}
+		for _, instance := range data.Instances {
+			t := instanceTransition(instance, instance.State)
+			seen[transitionKey(t)] = true
+			r.record(t, now)
+		}
+		for _, operator := range data.Operators {
+			t := model.StateTransition{Type: TypeOperator, Name: operator.Name, ID: operator.ID, To: operator.State}
+			seen[transitionKey(t)] = true
+			r.record(t, now)
+		}
+		// anything we knew about that isn't part of the full status is gone
+		for key, t := range r.last {
+			if !seen[key] && t.To != StateRemoved {
+				r.record(model.StateTransition{Type: t.Type, Name: t.Name, ID: t.ID, Provider: t.Provider, To: StateRemoved}, now)
+			}
+		}
+	case status.InstanceChange:
+		state := data.Instance.State
+		if data.Action == status.ActionRemoved {
+			state = StateRemoved
+		}
+		r.record(instanceTransition(data.Instance, state), now)
+	case status.OperatorChange:
+		state := data.Operator.State
+		if data.Action == status.ActionRemoved {
+			state = StateRemoved
+		}
+		r.record(model.StateTransition{Type: TypeOperator, Name: data.Operator.Name, ID: data.Operator.ID, To: state}, now)
+	}
+}
+
+func instanceTransition(instance model.InstanceState, state string) model.StateTransition {
+	t := model.StateTransition{
+		Type:     instance.Type,
+		Name:     instance.Name,
+		ID:       instance.BlockID,
+		Provider: instance.Metadata["kapeta.com/provider"],
+		To:       state,
+	}
+	if state != StateRemoved {
+		t.Reason, t.Message = instance.Reason, instance.Message
+	}
+	return t
+}
+
+// record adds the transition to its To state if it differs from the last one we saw
+func (r *Recorder) record(transition model.StateTransition, now time.Time) {
+	key := transitionKey(transition)
+	last, known := r.last[key]
+	if last.To == transition.To || (!known && transition.To == StateRemoved) {
+		return
+	}
+	transition.Timestamp = now.UnixMilli()
+	transition.From = last.To
+	r.last[key] = transition
+	r.transitions = append(r.transitions, transition)
+	r.dirty = true
+	r.trim(now)
+}
+
+// trim drops the transitions past the retention, except for the newest one of every instance
+// as it is the state the instance was in at the start of the history. Over maxEntries the oldest
+// transitions are dropped as well, unless it is the last state of an instance.
+func (r *Recorder) trim(now time.Time) {
+	cutoff := now.Add(-r.retention).UnixMilli()
+	newest := map[string]int{}
+	for i, t := range r.transitions {
+		if t.Timestamp >= cutoff {
+			break
+		}
+		newest[transitionKey(t)] = i
+	}
+	drop := make([]bool, len(r.transitions))
+	dropped := 0
+	for i, t := range r.transitions {
+		if t.Timestamp >= cutoff {
+			break
+		}
+		if newest[transitionKey(t)] != i || t.To == StateRemoved {
+			drop[i] = true
+			dropped++
+		}
+	}
+	for i, t := range r.transitions {
+		if len(r.transitions)-dropped <= r.maxEntries {
+			break
+		}
+		if !drop[i] && r.last[transitionKey(t)].Timestamp != t.Timestamp {
+			drop[i] = true
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return
+	}
+	transitions := make([]model.StateTransition, 0, len(r.transitions)-dropped)
+	for i, t := range r.transitions {
+		if !drop[i] {
+			transitions = append(transitions, t)
+		}
+	}
+	r.transitions = transitions
+	r.dirty = true
+}
+
+func (r *Recorder) flush(ctx context.Context) {
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return
+	}
+	transitions := append([]model.StateTransition{}, r.transitions...)
+	r.dirty = false
+	r.mu.Unlock()
+
+	if err := r.store.Save(ctx, transitions); err != nil {
+		log.Printf("error saving state history: %v\n", err)
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+	}
+}
+
+// transitionKey identifies an instance by its name and provider and an operator by its id, like the status stream does
+func transitionKey(t model.StateTransition) string {
+	if t.Type == TypeOperator {
+		return t.Type + "/" + t.ID
+	}
+	return status.InstanceKey(model.InstanceState{Type: t.Type, Name: t.Name, Metadata: map[string]string{"kapeta.com/provider": t.Provider}})
+}
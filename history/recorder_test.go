@@ -0,0 +1,145 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/kapetacom/insight-api/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorderHandle(t *testing.T) {
+	now := time.Now()
+	r := NewRecorder(nil, nil, time.Hour, 100)
+
+	r.handle(status.Event{Type: status.EventStatus, Data: &model.ClusterStatus{
+		Instances: []model.InstanceState{{Name: "todo", BlockID: "block-1", Type: model.TypeBlock, State: model.StateReady}},
+		Operators: []model.OperatorState{{ID: "db-1", Name: "mongodb", State: "Ready"}},
+	}}, now)
+	assert.Len(t, r.Timeline(Filter{}), 2)
+
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionUpdated,
+		Instance: model.InstanceState{Name: "todo", BlockID: "block-1", Type: model.TypeBlock, State: model.StateCrashLooping, Reason: "CrashLoopBackOff"},
+	}}, now.Add(time.Minute))
+	// an update without a change of state isn't a transition
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionUpdated,
+		Instance: model.InstanceState{Name: "todo", BlockID: "block-1", Type: model.TypeBlock, State: model.StateCrashLooping, Reason: "CrashLoopBackOff", ReadyReplicas: 1},
+	}}, now.Add(2*time.Minute))
+
+	timeline := r.Timeline(Filter{Instance: "block-1"})
+	assert.Len(t, timeline, 2)
+	assert.Equal(t, "", timeline[0].From)
+	assert.Equal(t, model.StateReady, timeline[0].To)
+	assert.Equal(t, model.StateReady, timeline[1].From)
+	assert.Equal(t, model.StateCrashLooping, timeline[1].To)
+	assert.Equal(t, "CrashLoopBackOff", timeline[1].Reason)
+
+	// a full status without the operator means it was removed
+	r.handle(status.Event{Type: status.EventStatus, Data: &model.ClusterStatus{
+		Instances: []model.InstanceState{{Name: "todo", BlockID: "block-1", Type: model.TypeBlock, State: model.StateReady}},
+	}}, now.Add(3*time.Minute))
+	operator := r.Timeline(Filter{Type: TypeOperator})
+	assert.Len(t, operator, 2)
+	assert.Equal(t, StateRemoved, operator[1].To)
+
+	assert.Len(t, r.Timeline(Filter{From: now.Add(time.Minute)}), 3)
+	assert.Len(t, r.Timeline(Filter{To: now}), 2)
+
+	// operators are known by their id, the name may be missing
+	r.handle(status.Event{Type: status.EventStatus, Data: &model.ClusterStatus{
+		Instances: []model.InstanceState{{Name: "todo", BlockID: "block-1", Type: model.TypeBlock, State: model.StateReady}},
+		Operators: []model.OperatorState{{ID: "db-1", State: "Ready"}, {ID: "db-2", State: "Failed"}},
+	}}, now.Add(4*time.Minute))
+	assert.Len(t, r.Timeline(Filter{Type: TypeOperator, Instance: "db-1"}), 3)
+	assert.Len(t, r.Timeline(Filter{Type: TypeOperator, Instance: "db-2"}), 1)
+}
+
+func TestRecorderRetention(t *testing.T) {
+	now := time.Now()
+	r := NewRecorder(nil, nil, time.Hour, 3)
+	states := []string{model.StateReady, model.StateDegraded, model.StateReady, model.StateDegraded}
+	for i, state := range states {
+		r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+			Action:   status.ActionUpdated,
+			Instance: model.InstanceState{Name: "todo", Type: model.TypeBlock, State: state},
+		}}, now.Add(time.Duration(i)*time.Minute))
+	}
+	timeline := r.Timeline(Filter{})
+	assert.Len(t, timeline, 3)
+	assert.Equal(t, now.Add(time.Minute).UnixMilli(), timeline[0].Timestamp)
+
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionUpdated,
+		Instance: model.InstanceState{Name: "todo", Type: model.TypeBlock, State: model.StateReady},
+	}}, now.Add(2*time.Hour))
+	// the state before the retention is kept to know what the instance was in at its start
+	timeline = r.Timeline(Filter{})
+	assert.Len(t, timeline, 2)
+	assert.Equal(t, model.StateDegraded, timeline[0].To)
+	assert.Equal(t, now.Add(3*time.Minute).UnixMilli(), timeline[0].Timestamp)
+
+	// a stable instance isn't forgotten, while a removed one is once its removal is past the retention
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionUpdated,
+		Instance: model.InstanceState{Name: "orders", Type: model.TypeBlock, State: model.StateReady},
+	}}, now.Add(3*time.Hour))
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionRemoved,
+		Instance: model.InstanceState{Name: "orders", Type: model.TypeBlock, State: model.StateReady},
+	}}, now.Add(3*time.Hour))
+	r.trim(now.Add(5 * time.Hour))
+	timeline = r.Timeline(Filter{})
+	assert.Len(t, timeline, 1)
+	assert.Equal(t, "todo", timeline[0].Name)
+	assert.Equal(t, model.StateReady, timeline[0].To)
+}
+
+func TestRecorderRestore(t *testing.T) {
+	store := &fileStore{path: t.TempDir() + "/history.json"}
+	now := time.Now()
+	err := store.Save(context.Background(), []model.StateTransition{
+		{Timestamp: now.Add(-time.Minute).UnixMilli(), Type: model.TypeBlock, Name: "todo", To: model.StateReady},
+	})
+	assert.NoError(t, err)
+
+	r := NewRecorder(nil, store, time.Hour, 100)
+	transitions, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	r.restore(transitions)
+
+	// the instance is still ready so nothing is recorded after a restart
+	r.handle(status.Event{Type: status.EventStatus, Data: &model.ClusterStatus{
+		Instances: []model.InstanceState{{Name: "todo", Type: model.TypeBlock, State: model.StateReady}},
+	}}, now)
+	assert.Len(t, r.Timeline(Filter{}), 1)
+
+	r.handle(status.Event{Type: status.EventInstance, Data: status.InstanceChange{
+		Action:   status.ActionRemoved,
+		Instance: model.InstanceState{Name: "todo", Type: model.TypeBlock, State: model.StateReady},
+	}}, now)
+	r.flush(context.Background())
+	stored, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stored, 2)
+	assert.Equal(t, StateRemoved, stored[1].To)
+}
+
+func TestRecorderGatewayProviders(t *testing.T) {
+	now := time.Now()
+	r := NewRecorder(nil, nil, time.Hour, 100)
+	gateway := func(provider string, state string) model.InstanceState {
+		return model.InstanceState{Name: "todo", Type: model.TypeGateway, State: state, Metadata: map[string]string{"kapeta.com/provider": provider}}
+	}
+	r.handle(status.Event{Type: status.EventStatus, Data: &model.ClusterStatus{
+		Instances: []model.InstanceState{gateway("ingress", model.StateReady), gateway("gateway-api", model.StateFailed)},
+	}}, now)
+
+	timeline := r.Timeline(Filter{Instance: "todo"})
+	assert.Len(t, timeline, 2)
+	assert.Equal(t, "ingress", timeline[0].Provider)
+	assert.Equal(t, "gateway-api", timeline[1].Provider)
+}
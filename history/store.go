@@ -0,0 +1,138 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kapetacom/insight-api/kubernetes"
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+const (
+	HistoryNamespace = "kapeta"
+	HistoryConfigMap = "insight-state-history"
+	HistoryKey       = "history.json"
+)
+
+// Store persists the recorded transitions, Save replaces everything stored before
+type Store interface {
+	Load(ctx context.Context) ([]model.StateTransition, error)
+	Save(ctx context.Context, transitions []model.StateTransition) error
+}
+
+// NewStore returns a file store if STATE_HISTORY_FILE is set, otherwise the
+// transitions are kept in a ConfigMap in the kapeta namespace
+func NewStore() (Store, error) {
+	if path := os.Getenv("STATE_HISTORY_FILE"); path != "" {
+		return &fileStore{path: path}, nil
+	}
+	clientset, err := kubernetes.KubernetesClient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting kubernetes client: %v", err)
+	}
+	return &configMapStore{clientset: clientset}, nil
+}
+
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Load(ctx context.Context) ([]model.StateTransition, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []model.StateTransition{}, nil
+		}
+		return nil, fmt.Errorf("error reading state history: %v", err)
+	}
+	return decode(data)
+}
+
+func (s *fileStore) Save(ctx context.Context, transitions []model.StateTransition) error {
+	data, err := json.Marshal(transitions)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a truncated history behind
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing state history: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing state history: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state history: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error writing state history: %v", err)
+	}
+	return nil
+}
+
+type configMapStore struct {
+	clientset k8s.Interface
+}
+
+func (s *configMapStore) Load(ctx context.Context) ([]model.StateTransition, error) {
+	cm, err := s.clientset.CoreV1().ConfigMaps(HistoryNamespace).Get(ctx, HistoryConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return []model.StateTransition{}, nil
+		}
+		return nil, fmt.Errorf("error getting state history: %v", err)
+	}
+	data, ok := cm.Data[HistoryKey]
+	if !ok {
+		return []model.StateTransition{}, nil
+	}
+	return decode([]byte(data))
+}
+
+func (s *configMapStore) Save(ctx context.Context, transitions []model.StateTransition) error {
+	data, err := json.Marshal(transitions)
+	if err != nil {
+		return err
+	}
+	configMaps := s.clientset.CoreV1().ConfigMaps(HistoryNamespace)
+	cm, err := configMaps.Get(ctx, HistoryConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: HistoryConfigMap, Namespace: HistoryNamespace},
+			Data:       map[string]string{HistoryKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("error creating state history: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting state history: %v", err)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[HistoryKey] = string(data)
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error updating state history: %v", err)
+	}
+	return nil
+}
+
+func decode(data []byte) ([]model.StateTransition, error) {
+	transitions := []model.StateTransition{}
+	if err := json.Unmarshal(data, &transitions); err != nil {
+		return nil, fmt.Errorf("error decoding state history: %v", err)
+	}
+	return transitions, nil
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapStore(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	store := &configMapStore{clientset: clientset}
+
+	transitions, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	first := []model.StateTransition{{Timestamp: 1, Type: model.TypeBlock, Name: "todo", To: model.StateReady}}
+	assert.NoError(t, store.Save(ctx, first))
+	second := append(first, model.StateTransition{Timestamp: 2, Type: model.TypeBlock, Name: "todo", From: model.StateReady, To: model.StateDegraded})
+	assert.NoError(t, store.Save(ctx, second))
+
+	transitions, err = store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, second, transitions)
+
+	cm, err := clientset.CoreV1().ConfigMaps(HistoryNamespace).Get(ctx, HistoryConfigMap, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data[HistoryKey], `"to":"Degraded"`)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := &fileStore{path: t.TempDir() + "/history.json"}
+
+	transitions, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	saved := []model.StateTransition{{Timestamp: 1, Type: model.TypeBlock, Name: "todo", To: model.StateReady}}
+	assert.NoError(t, store.Save(ctx, saved))
+	transitions, err = store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, transitions)
+}
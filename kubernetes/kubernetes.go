@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/kapetacom/schemas/packages/go/model"
 	"github.com/mitchellh/go-homedir"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -15,7 +19,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// GetDeployment returns the deployment object from the kapeta secret in the cluster, this is the latest version deployed
+// GetDeployment returns the deployment object from the kapeta secret with the latest environment version
 func GetDeployment(ctx context.Context) (*model.Deployment, error) {
 	labelSelector := "kapeta.com/environment-name"
 
@@ -30,11 +34,78 @@ func GetDeployment(ctx context.Context) (*model.Deployment, error) {
 	if err != nil {
 		panic(err.Error())
 	}
-	secret := secrets.Items[0]
+	if len(secrets.Items) == 0 {
+		return nil, fmt.Errorf("no deployment secret found")
+	}
+	items := []*corev1.Secret{}
+	for i := range secrets.Items {
+		items = append(items, &secrets.Items[i])
+	}
+	return DecodeDeployment(LatestSecret(items))
+}
+
+// LatestSecret returns the secret with the newest environment version, nil if there are none
+func LatestSecret(secrets []*corev1.Secret) *corev1.Secret {
+	if len(secrets) == 0 {
+		return nil
+	}
+	sorted := SortByEnvironmentVersion(secrets)
+	return sorted[0]
+}
+
+// SortByEnvironmentVersion returns the secrets ordered from the newest environment version to the oldest,
+// secrets with the same version are ordered by creation time and name so the order is always the same
+func SortByEnvironmentVersion(secrets []*corev1.Secret) []*corev1.Secret {
+	sorted := append([]*corev1.Secret{}, secrets...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if c := CompareVersions(a.Labels["kapeta.com/environment-version"], b.Labels["kapeta.com/environment-version"]); c != 0 {
+			return c > 0
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return b.CreationTimestamp.Before(&a.CreationTimestamp)
+		}
+		return a.Name > b.Name
+	})
+	return sorted
+}
+
+// CompareVersions compares versions like 12 or 1.2.3 part by part, numerically where both parts are numbers
+func CompareVersions(a string, b string) int {
+	as := strings.FieldsFunc(a, isVersionSeparator)
+	bs := strings.FieldsFunc(b, isVersionSeparator)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an > bn {
+				return 1
+			}
+			return -1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	switch {
+	case len(as) > len(bs):
+		return 1
+	case len(as) < len(bs):
+		return -1
+	}
+	return 0
+}
+
+func isVersionSeparator(r rune) bool {
+	return r == '.' || r == '-' || r == '+'
+}
+
+// DecodeDeployment decodes the deployment object stored in a kapeta secret
+func DecodeDeployment(secret *corev1.Secret) (*model.Deployment, error) {
 	data := secret.Data["config"]
 
 	deployment := &model.Deployment{}
-	err = json.Unmarshal(data, deployment)
+	err := json.Unmarshal(data, deployment)
 	if err != nil {
 		return nil, err
 	}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
 	"time"
 
 	kapkube "github.com/kapetacom/insight-api/kubernetes"
@@ -36,6 +38,10 @@ func logBlockById(c echo.Context) error {
 		namespace = c.QueryParam("namespace")
 	}
 	ctx := c.Request().Context()
+	limits, err := requestLimits(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
 	clientset, err := kapkube.KubernetesClient()
 	if err != nil {
@@ -53,7 +59,7 @@ func logBlockById(c echo.Context) error {
 		return fmt.Errorf("no pods found with label kapeta.com/block-id=%s", podName)
 
 	}
-	return writeLog(ctx, c, podList, namespace, clientset, tail, previous, container)
+	return writeLog(ctx, c, podList, namespace, clientset, tail, previous, container, limits)
 }
 
 func logBlockByName(c echo.Context) error {
@@ -70,6 +76,10 @@ func logBlockByName(c echo.Context) error {
 	}
 
 	ctx := c.Request().Context()
+	limits, err := requestLimits(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	clientset, err := kapkube.KubernetesClient()
 	if err != nil {
 		return fmt.Errorf("error getting kubernetes client: %v", err)
@@ -85,18 +95,28 @@ func logBlockByName(c echo.Context) error {
 	if len(podList.Items) == 0 {
 		return fmt.Errorf("no pods found with label instance=%s", podName)
 	}
-	return writeLog(ctx, c, podList, namespace, clientset, tail, previous, container)
+	return writeLog(ctx, c, podList, namespace, clientset, tail, previous, container, limits)
 }
 
-func writeLog(ctx context.Context, c echo.Context, podList *corev1.PodList, namespace string, clientset *kubernetes.Clientset, tail bool, previous bool, container string) error {
+func writeLog(ctx context.Context, c echo.Context, podList *corev1.PodList, namespace string, clientset *kubernetes.Clientset, tail bool, previous bool, container string, limits LogLimits) error {
+	budget := newLogBudget(limits)
+	if tail {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.MaxFollowDuration)
+		defer cancel()
+	}
 	for _, pod := range podList.Items {
 		podName := pod.Name
-		req := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		opts := &corev1.PodLogOptions{
 			Follow:     tail,
 			Previous:   previous,
 			Timestamps: true,
 			Container:  container,
-		})
+		}
+		if limits.TailLines > 0 {
+			opts.TailLines = &limits.TailLines
+		}
+		req := clientset.CoreV1().Pods(namespace).GetLogs(podName, opts)
 		readCloser, err := req.Stream(ctx)
 		if err != nil {
 			writeErrorToClient(*json.NewEncoder(c.Response()), err)
@@ -120,34 +140,52 @@ func writeLog(ctx context.Context, c echo.Context, podList *corev1.PodList, name
 		entries := make([]*LogEntry, 0)
 
 		for lineReader.Scan() {
-			line := lineReader.Text()
-			// Split the line into timestamp and message
-			timestamp := line[0:30]
-			message := line[31:]
-
-			miliseconds := int64(0)
-			parsedTime, err := time.Parse(time.RFC3339, timestamp)
-			if err == nil {
-				miliseconds = parsedTime.UnixMilli()
+			logEntry := parseLogLine(podName, lineReader.Text())
+			if !budget.take(logEntry) {
+				break
 			}
+			entries = append(entries, logEntry)
+		}
+		if tail && ctx.Err() == context.DeadlineExceeded {
+			budget.followExpired()
+		}
 
-			logEntry := LogEntry{
-				Entity:    podName,
-				Severity:  "INFO",
-				Timestamp: miliseconds,
-				Message:   message,
-			}
-			entries = append(entries, &logEntry)
+		if budget.truncated() {
+			entries = append(entries, budget.notice())
 		}
 
 		err = enc.Encode(entries)
 		if err != nil {
 			return fmt.Errorf("error writing to response: %v", err)
 		}
+		if budget.truncated() {
+			break
+		}
 	}
 	return nil
 }
 
+// parseLogLine splits a kubernetes log line with timestamps into a LogEntry
+func parseLogLine(podName string, line string) *LogEntry {
+	timestamp, message, found := strings.Cut(line, " ")
+	if !found {
+		message = line
+	}
+
+	miliseconds := int64(0)
+	parsedTime, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err == nil {
+		miliseconds = parsedTime.UnixMilli()
+	}
+
+	return &LogEntry{
+		Entity:    podName,
+		Severity:  "INFO",
+		Timestamp: miliseconds,
+		Message:   message,
+	}
+}
+
 func writeErrorToClient(enc json.Encoder, err error) {
 	logEntry := LogEntry{
 		Entity:    "system",
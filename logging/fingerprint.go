@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"regexp"
+	"sort"
+)
+
+var (
+	quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	uuidPattern   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	ipPattern     = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	hexPattern    = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]{16,}\b`)
+	numberPattern = regexp.MustCompile(`\b\d+(?:\.\d+)?`)
+)
+
+// Fingerprint returns the template of a log message, quoted strings, uuids, ip addresses
+// and numbers are masked so that repeated messages share the same template
+func Fingerprint(message string) string {
+	template := quotedPattern.ReplaceAllString(message, "<str>")
+	template = uuidPattern.ReplaceAllString(template, "<uuid>")
+	template = ipPattern.ReplaceAllString(template, "<ip>")
+	template = hexPattern.ReplaceAllString(template, "<hex>")
+	template = numberPattern.ReplaceAllString(template, "<num>")
+	return template
+}
+
+// TemplateSummary is a group of log entries sharing the same template
+type TemplateSummary struct {
+	Template  string    `json:"template"`
+	Count     int       `json:"count"`
+	FirstSeen int64     `json:"firstSeen"`
+	LastSeen  int64     `json:"lastSeen"`
+	Example   *LogEntry `json:"example"`
+}
+
+// Summarize groups the entries by template, the most frequent templates come first
+func Summarize(entries []*LogEntry) []*TemplateSummary {
+	templates := map[string]*TemplateSummary{}
+	for _, entry := range entries {
+		template := Fingerprint(entry.Message)
+		summary, ok := templates[template]
+		if !ok {
+			summary = &TemplateSummary{
+				Template:  template,
+				FirstSeen: entry.Timestamp,
+				LastSeen:  entry.Timestamp,
+				Example:   entry,
+			}
+			templates[template] = summary
+		}
+		summary.Count++
+		if entry.Timestamp < summary.FirstSeen {
+			summary.FirstSeen = entry.Timestamp
+		}
+		if entry.Timestamp > summary.LastSeen {
+			summary.LastSeen = entry.Timestamp
+			summary.Example = entry
+		}
+	}
+
+	result := make([]*TemplateSummary, 0, len(templates))
+	for _, summary := range templates {
+		result = append(result, summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].LastSeen > result[j].LastSeen
+	})
+	return result
+}
@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(t, "user <uuid> not found", Fingerprint("user 3f1c2a9e-8b4d-4c2f-9a1e-2b3c4d5e6f70 not found"))
+	assert.Equal(t, "connection to <ip> refused after <num>ms", Fingerprint("connection to 10.0.0.12:5432 refused after 250ms"))
+	assert.Equal(t, "invalid value <str> for field <str>", Fingerprint(`invalid value "abc 123" for field 'name'`))
+	assert.Equal(t, "took <num> seconds, pointer <hex>", Fingerprint("took 1.5 seconds, pointer 0xc000123abc"))
+}
+
+func TestSummarize(t *testing.T) {
+	entries := []*LogEntry{
+		{Timestamp: 1, Message: "request 1 failed"},
+		{Timestamp: 5, Message: "request 2 failed"},
+		{Timestamp: 3, Message: "started"},
+		{Timestamp: 4, Message: "request 3 failed"},
+	}
+	summaries := Summarize(entries)
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, "request <num> failed", summaries[0].Template)
+	assert.Equal(t, 3, summaries[0].Count)
+	assert.Equal(t, int64(1), summaries[0].FirstSeen)
+	assert.Equal(t, int64(5), summaries[0].LastSeen)
+	assert.Equal(t, "request 2 failed", summaries[0].Example.Message)
+	assert.Equal(t, "started", summaries[1].Template)
+}
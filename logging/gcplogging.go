@@ -13,7 +13,6 @@ import (
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"net/http"
-	"strings"
 )
 
 func logClient(ctx context.Context) (*logadmin.Client, error) {
@@ -42,14 +41,17 @@ func GCPLogHandler(c echo.Context) error {
 	// In labels "/" is not allowed - so it's seperated by "-" instead
 	deployment := deploymentHandle + "-" + deploymentName
 
+	limits, err := requestLimits(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
 	client, err := logClient(c.Request().Context())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create log client")
 	}
 
-	filter := "labels.\"k8s-pod/instance\"=\"" + instanceId + "\" " +
-		"labels.\"k8s-pod/deployment\"=\"" + deployment + "\" " +
-		"resource.type=\"k8s_container\""
+	filter := gcpFilter(instanceId, deployment)
 
 	it := client.Entries(c.Request().Context(), logadmin.Filter(filter), logadmin.NewestFirst())
 	pageToken := ""
@@ -58,6 +60,8 @@ func GCPLogHandler(c echo.Context) error {
 	enc := json.NewEncoder(c.Response())
 	var gcpLogEntries []*logging.Entry
 	entries := make([]*LogEntry, 0)
+	budget := newLogBudget(limits)
+pages:
 	for {
 		nextTok, err := iterator.NewPager(it, 100, pageToken).NextPage(&gcpLogEntries)
 		if err != nil {
@@ -68,13 +72,14 @@ func GCPLogHandler(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get next page of logs: %v", err))
 		}
 		for _, gcpLogEntry := range gcpLogEntries {
-			logEntry := LogEntry{
-				Entity:    gcpLogEntry.Resource.Labels["container_name"],
-				Timestamp: gcpLogEntry.Timestamp.UnixMilli(),
-				Severity:  strings.ToUpper(gcpLogEntry.Severity.String()),
-				Message:   fmt.Sprintf("%v", gcpLogEntry.Payload),
+			if limits.TailLines > 0 && int64(len(entries)) >= limits.TailLines {
+				break pages
 			}
-			entries = append(entries, &logEntry)
+			logEntry := toLogEntry(gcpLogEntry)
+			if !budget.take(logEntry) {
+				break pages
+			}
+			entries = append(entries, logEntry)
 		}
 
 		c.Response().Flush()
@@ -84,6 +89,10 @@ func GCPLogHandler(c echo.Context) error {
 		pageToken = nextTok
 	}
 
+	if budget.truncated() {
+		entries = append(entries, budget.notice())
+	}
+
 	err = enc.Encode(entries)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to encode log output")
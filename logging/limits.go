@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultMaxLines          = 10000
+	defaultMaxBytes          = 5 * 1024 * 1024
+	defaultMaxFollowDuration = 5 * time.Minute
+)
+
+// LogLimits caps how much log data a single request is allowed to pull
+type LogLimits struct {
+	MaxLines          int
+	MaxBytes          int64
+	MaxFollowDuration time.Duration
+	// TailLines is the number of most recent lines to return, 0 means all
+	TailLines int64
+}
+
+// LimitsFromEnv returns the server wide limits, configured through the
+// LOG_MAX_LINES, LOG_MAX_BYTES and LOG_MAX_FOLLOW_DURATION environment variables
+func LimitsFromEnv() LogLimits {
+	limits := LogLimits{
+		MaxLines:          defaultMaxLines,
+		MaxBytes:          defaultMaxBytes,
+		MaxFollowDuration: defaultMaxFollowDuration,
+	}
+	if v, err := strconv.Atoi(os.Getenv("LOG_MAX_LINES")); err == nil && v > 0 {
+		limits.MaxLines = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("LOG_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		limits.MaxBytes = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("LOG_MAX_FOLLOW_DURATION")); err == nil && v > 0 {
+		limits.MaxFollowDuration = v
+	}
+	return limits
+}
+
+// requestLimits returns the limits for the current request, the query parameters
+// maxLines, maxBytes and maxFollow can only lower the server wide limits
+func requestLimits(c echo.Context) (LogLimits, error) {
+	limits := LimitsFromEnv()
+	if v := c.QueryParam("maxLines"); v != "" {
+		maxLines, err := strconv.Atoi(v)
+		if err != nil || maxLines <= 0 {
+			return limits, fmt.Errorf("invalid maxLines %q", v)
+		}
+		limits.MaxLines = min(limits.MaxLines, maxLines)
+	}
+	if v := c.QueryParam("maxBytes"); v != "" {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			return limits, fmt.Errorf("invalid maxBytes %q", v)
+		}
+		limits.MaxBytes = min(limits.MaxBytes, maxBytes)
+	}
+	if v := c.QueryParam("maxFollow"); v != "" {
+		maxFollow, err := time.ParseDuration(v)
+		if err != nil || maxFollow <= 0 {
+			return limits, fmt.Errorf("invalid maxFollow %q", v)
+		}
+		limits.MaxFollowDuration = min(limits.MaxFollowDuration, maxFollow)
+	}
+	if v := c.QueryParam("tailLines"); v != "" {
+		tailLines, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || tailLines <= 0 {
+			return limits, fmt.Errorf("invalid tailLines %q", v)
+		}
+		limits.TailLines = tailLines
+	}
+	return limits, nil
+}
+
+// logBudget keeps track of how much of the limits a request has used
+type logBudget struct {
+	limits LogLimits
+	lines  int
+	bytes  int64
+	reason string
+}
+
+func newLogBudget(limits LogLimits) *logBudget {
+	return &logBudget{limits: limits}
+}
+
+// take accounts for the entry and returns false if it would exceed the limits
+func (b *logBudget) take(entry *LogEntry) bool {
+	if b.reason != "" {
+		return false
+	}
+	if b.lines+1 > b.limits.MaxLines {
+		b.reason = fmt.Sprintf("maximum of %d lines reached", b.limits.MaxLines)
+		return false
+	}
+	size := int64(len(entry.Message))
+	if b.bytes+size > b.limits.MaxBytes {
+		b.reason = fmt.Sprintf("maximum of %d bytes reached", b.limits.MaxBytes)
+		return false
+	}
+	b.lines++
+	b.bytes += size
+	return true
+}
+
+// takeNewest accounts for the entries from the newest to the oldest and returns the
+// newest ones that fit within the limits, oldest first
+func (b *logBudget) takeNewest(entries []*LogEntry) []*LogEntry {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !b.take(entries[i]) {
+			return entries[i+1:]
+		}
+	}
+	return entries
+}
+
+// followExpired marks the budget as truncated because the follow duration ran out
+func (b *logBudget) followExpired() {
+	if b.reason == "" {
+		b.reason = fmt.Sprintf("maximum follow duration of %v reached", b.limits.MaxFollowDuration)
+	}
+}
+
+func (b *logBudget) truncated() bool {
+	return b.reason != ""
+}
+
+// notice returns the entry telling the client that the output was truncated
+func (b *logBudget) notice() *LogEntry {
+	return &LogEntry{
+		Entity:    "system",
+		Severity:  "WARNING",
+		Timestamp: time.Now().UnixMilli(),
+		Message:   "log output truncated: " + b.reason,
+	}
+}
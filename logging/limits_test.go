@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogBudget(t *testing.T) {
+	t.Run("should stop at the maximum number of lines", func(t *testing.T) {
+		budget := newLogBudget(LogLimits{MaxLines: 2, MaxBytes: 1024})
+		assert.True(t, budget.take(&LogEntry{Message: "one"}))
+		assert.True(t, budget.take(&LogEntry{Message: "two"}))
+		assert.False(t, budget.take(&LogEntry{Message: "three"}))
+		assert.True(t, budget.truncated())
+		assert.Contains(t, budget.notice().Message, "maximum of 2 lines")
+	})
+
+	t.Run("should stop at the maximum number of bytes", func(t *testing.T) {
+		budget := newLogBudget(LogLimits{MaxLines: 100, MaxBytes: 5})
+		assert.True(t, budget.take(&LogEntry{Message: "abc"}))
+		assert.False(t, budget.take(&LogEntry{Message: "abc"}))
+		assert.Contains(t, budget.notice().Message, "maximum of 5 bytes")
+	})
+
+	t.Run("should keep the newest entries that fit", func(t *testing.T) {
+		budget := newLogBudget(LogLimits{MaxLines: 2, MaxBytes: 1024})
+		entries := []*LogEntry{{Message: "one"}, {Message: "two"}, {Message: "three"}}
+		assert.Equal(t, entries[1:], budget.takeNewest(entries))
+		assert.True(t, budget.truncated())
+
+		budget = newLogBudget(LogLimits{MaxLines: 5, MaxBytes: 1024})
+		assert.Equal(t, entries, budget.takeNewest(entries))
+		assert.False(t, budget.truncated())
+	})
+
+	t.Run("should report an expired follow", func(t *testing.T) {
+		budget := newLogBudget(LogLimits{MaxLines: 100, MaxBytes: 100, MaxFollowDuration: time.Minute})
+		assert.False(t, budget.truncated())
+		budget.followExpired()
+		assert.True(t, budget.truncated())
+		assert.Contains(t, budget.notice().Message, "follow duration of 1m0s")
+	})
+}
+
+func TestRequestLimits(t *testing.T) {
+	e := echo.New()
+
+	t.Run("should only lower the server limits", func(t *testing.T) {
+		t.Setenv("LOG_MAX_LINES", "50")
+		req := httptest.NewRequest("GET", "/?maxLines=500&maxBytes=10&tailLines=20", nil)
+		limits, err := requestLimits(e.NewContext(req, httptest.NewRecorder()))
+		assert.NoError(t, err)
+		assert.Equal(t, 50, limits.MaxLines)
+		assert.Equal(t, int64(10), limits.MaxBytes)
+		assert.Equal(t, int64(20), limits.TailLines)
+		assert.Equal(t, defaultMaxFollowDuration, limits.MaxFollowDuration)
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/?tailLines=-1", nil)
+		_, err := requestLimits(e.NewContext(req, httptest.NewRecorder()))
+		assert.Error(t, err)
+	})
+}
+
+func TestParseLogLine(t *testing.T) {
+	entry := parseLogLine("pod-1", "2024-04-22T10:11:12.123456789Z hello world")
+	assert.Equal(t, "pod-1", entry.Entity)
+	assert.Equal(t, "hello world", entry.Message)
+	assert.Equal(t, int64(1713780672123), entry.Timestamp)
+
+	entry = parseLogLine("pod-1", "short")
+	assert.Equal(t, "short", entry.Message)
+	assert.Equal(t, int64(0), entry.Timestamp)
+}
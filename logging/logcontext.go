@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultContextLines  = 50
+	maxContextLines      = 500
+	defaultContextWindow = time.Hour
+)
+
+// LogContext holds the entries logged right before and after a point in time
+type LogContext struct {
+	Timestamp int64 `json:"timestamp"`
+	// Before are the entries logged before the timestamp, oldest first
+	Before []*LogEntry `json:"before"`
+	// After are the entries logged at or after the timestamp, oldest first
+	After []*LogEntry `json:"after"`
+	// BeforeTruncated and AfterTruncated are true if the log limits cut the lines short
+	BeforeTruncated bool `json:"beforeTruncated"`
+	AfterTruncated  bool `json:"afterTruncated"`
+}
+
+// LogContextHandler returns the lines surrounding a timestamp for a pod or entity of an instance,
+// regardless of any filter the user has applied to the log stream
+func LogContextHandler(mode string) echo.HandlerFunc {
+	source := NewSource(mode)
+	return func(c echo.Context) error {
+		instanceId := c.Param("instance")
+		deploymentHandle := c.Param("deploymentHandle")
+		deploymentName := c.Param("deploymentName")
+
+		if !jwt.HasScopeForHandle(c, deploymentHandle, scopes.LOGGING_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.LOGGING_READ_SCOPE, deploymentHandle))
+		}
+
+		pod := c.QueryParam("pod")
+		entity := c.QueryParam("entity")
+		if pod == "" && entity == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "either pod or entity is required")
+		}
+		if err := validateTarget(pod, entity); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		ms, err := strconv.ParseInt(c.QueryParam("timestamp"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid timestamp %q", c.QueryParam("timestamp")))
+		}
+		at := time.UnixMilli(ms)
+
+		lines := int64(defaultContextLines)
+		if v := c.QueryParam("lines"); v != "" {
+			lines, err = strconv.ParseInt(v, 10, 64)
+			if err != nil || lines <= 0 || lines > maxContextLines {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("lines must be between 1 and %d", maxContextLines))
+			}
+		}
+		window := defaultContextWindow
+		if v := c.QueryParam("window"); v != "" {
+			window, err = time.ParseDuration(v)
+			if err != nil || window <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid window %q", v))
+			}
+		}
+
+		query := Query{
+			Instance:   instanceId,
+			Deployment: deploymentHandle + "-" + deploymentName,
+			Pod:        pod,
+			Entity:     entity,
+			Limits:     LimitsFromEnv(),
+		}
+		ctx := c.Request().Context()
+
+		// the lines before are the tail of the window leading up to the timestamp
+		before := query
+		before.Since = at.Add(-window)
+		before.Until = at.Add(-time.Millisecond)
+		before.Limits.TailLines = lines
+		beforeEntries, beforeTruncated, err := source.Entries(ctx, before)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get logs: %v", err))
+		}
+
+		// and the lines after are the head of the window following it
+		after := query
+		after.Since = at
+		after.Until = at.Add(window)
+		after.Head = lines
+		afterEntries, afterTruncated, err := source.Entries(ctx, after)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get logs: %v", err))
+		}
+
+		return c.JSON(http.StatusOK, LogContext{
+			Timestamp:       ms,
+			Before:          beforeEntries,
+			After:           afterEntries,
+			BeforeTruncated: beforeTruncated,
+			AfterTruncated:  afterTruncated,
+		})
+	}
+}
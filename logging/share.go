@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultShareTTL = time.Hour
+	maxShareTTL     = 24 * time.Hour
+)
+
+// ShareLink is the log window encoded in a signed share link
+type ShareLink struct {
+	Instance   string `json:"instance"`
+	Deployment string `json:"deployment"`
+	Pod        string `json:"pod,omitempty"`
+	Entity     string `json:"entity,omitempty"`
+	Severity   string `json:"severity,omitempty"`
+	From       int64  `json:"from"`
+	To         int64  `json:"to"`
+	Expires    int64  `json:"expires"`
+}
+
+// LinkSigner signs and verifies share links with HMAC-SHA256
+type LinkSigner struct {
+	key []byte
+}
+
+// NewLinkSigner returns a signer using the secret, without a secret a random key is used
+// which means that links stop working when the service restarts
+func NewLinkSigner(secret string) *LinkSigner {
+	if secret != "" {
+		return &LinkSigner{key: []byte(secret)}
+	}
+	log.Println("SHARE_LINK_SECRET is not set, share links will not survive a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err.Error())
+	}
+	return &LinkSigner{key: key}
+}
+
+// Sign returns the token for the link
+func (s *LinkSigner) Sign(link *ShareLink) (string, error) {
+	payload, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.signature(encoded), nil
+}
+
+// Verify returns the link of a token if the signature is valid and the link hasn't expired
+func (s *LinkSigner) Verify(token string, now time.Time) (*ShareLink, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(encoded))) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	link := &ShareLink{}
+	if err := json.Unmarshal(payload, link); err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if now.UnixMilli() > link.Expires {
+		return nil, fmt.Errorf("link has expired")
+	}
+	return link, nil
+}
+
+func (s *LinkSigner) signature(encoded string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type shareResponse struct {
+	URL     string `json:"url"`
+	Expires int64  `json:"expires"`
+}
+
+// CreateShareLink mints a short-lived link to a read-only, redacted view of a log window
+func CreateShareLink(signer *LinkSigner) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		instanceId := c.Param("instance")
+		deploymentHandle := c.Param("deploymentHandle")
+		deploymentName := c.Param("deploymentName")
+
+		if !jwt.HasScopeForHandle(c, deploymentHandle, scopes.LOGGING_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.LOGGING_READ_SCOPE, deploymentHandle))
+		}
+
+		from, to, err := requestWindow(c, time.Hour)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := validateTarget(c.QueryParam("pod"), c.QueryParam("entity")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		ttl := defaultShareTTL
+		if v := c.QueryParam("ttl"); v != "" {
+			ttl, err = time.ParseDuration(v)
+			if err != nil || ttl <= 0 || ttl > maxShareTTL {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ttl must be a duration up to %v", maxShareTTL))
+			}
+		}
+		baseURL, err := shareBaseURL(os.Getenv("SHARE_LINK_BASE_URL"), c.Scheme(), c.Request().Host)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		expires := time.Now().Add(ttl)
+
+		token, err := signer.Sign(&ShareLink{
+			Instance:   instanceId,
+			Deployment: deploymentHandle + "-" + deploymentName,
+			Pod:        c.QueryParam("pod"),
+			Entity:     c.QueryParam("entity"),
+			Severity:   c.QueryParam("severity"),
+			From:       from.UnixMilli(),
+			To:         to.UnixMilli(),
+			Expires:    expires.UnixMilli(),
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to sign link")
+		}
+
+		return c.JSON(http.StatusOK, shareResponse{
+			URL:     strings.TrimSuffix(baseURL, "/") + "/shared/logs?token=" + url.QueryEscape(token),
+			Expires: expires.UnixMilli(),
+		})
+	}
+}
+
+// shareBaseURL returns the configured base URL of share links. The host of the request is set by
+// the caller, so it is only used for local development where nothing is configured.
+func shareBaseURL(configured string, scheme string, host string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" || net.ParseIP(hostname).IsLoopback() {
+		return scheme + "://" + host, nil
+	}
+	return "", fmt.Errorf("the base URL of share links is not configured, set SHARE_LINK_BASE_URL")
+}
+
+// SharedLogHandler serves the log window of a share link, it doesn't require a kapeta token
+func SharedLogHandler(mode string, signer *LinkSigner) echo.HandlerFunc {
+	source := NewSource(mode)
+	return func(c echo.Context) error {
+		link, err := signer.Verify(c.QueryParam("token"), time.Now())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		}
+
+		entries, truncated, err := source.Entries(c.Request().Context(), Query{
+			Instance:   link.Instance,
+			Deployment: link.Deployment,
+			Pod:        link.Pod,
+			Entity:     link.Entity,
+			Severity:   link.Severity,
+			Since:      time.UnixMilli(link.From),
+			Until:      time.UnixMilli(link.To),
+			Limits:     LimitsFromEnv(),
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get logs")
+		}
+
+		result := make([]*LogEntry, 0, len(entries))
+		for _, entry := range entries {
+			redacted := *entry
+			redacted.Message = Redact(entry.Message)
+			result = append(result, &redacted)
+		}
+		if truncated {
+			result = append(result, &LogEntry{
+				Entity:    "system",
+				Severity:  "WARNING",
+				Timestamp: time.Now().UnixMilli(),
+				Message:   "log output truncated: the shared window exceeds the log limits",
+			})
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkSigner(t *testing.T) {
+	signer := NewLinkSigner("secret")
+	now := time.Now()
+	link := &ShareLink{Instance: "block-1", Deployment: "kapeta-prod", From: 1, To: 2, Expires: now.Add(time.Hour).UnixMilli()}
+
+	t.Run("should verify a signed link", func(t *testing.T) {
+		token, err := signer.Sign(link)
+		assert.NoError(t, err)
+		verified, err := signer.Verify(token, now)
+		assert.NoError(t, err)
+		assert.Equal(t, link, verified)
+	})
+
+	t.Run("should reject a tampered link", func(t *testing.T) {
+		token, _ := signer.Sign(link)
+		other, _ := signer.Sign(&ShareLink{Instance: "block-2", Expires: link.Expires})
+		payload, _, _ := strings.Cut(other, ".")
+		_, signature, _ := strings.Cut(token, ".")
+		_, err := signer.Verify(payload+"."+signature, now)
+		assert.Error(t, err)
+
+		_, err = NewLinkSigner("another secret").Verify(token, now)
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject an expired link", func(t *testing.T) {
+		token, _ := signer.Sign(link)
+		_, err := signer.Verify(token, now.Add(2*time.Hour))
+		assert.ErrorContains(t, err, "expired")
+	})
+}
+
+func TestShareBaseURL(t *testing.T) {
+	baseURL, err := shareBaseURL("https://insight.kapeta.com", "http", "attacker.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://insight.kapeta.com", baseURL)
+
+	// the request host is only trusted for local development
+	for _, host := range []string{"localhost:8080", "127.0.0.1", "[::1]:8080"} {
+		baseURL, err = shareBaseURL("", "http", host)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://"+host, baseURL)
+	}
+	_, err = shareBaseURL("", "http", "attacker.example.com")
+	assert.Error(t, err)
+	_, err = shareBaseURL("", "http", "localhost.attacker.example.com:8080")
+	assert.Error(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "password=<redacted> user=bob", Redact("password=hunter2 user=bob"))
+	assert.Equal(t, `{"apiKey": "<redacted>"}`, Redact(`{"apiKey": "abc123"}`))
+	assert.Equal(t, "Authorization: Bearer <redacted>", Redact("Authorization: Bearer abc.def.ghi"))
+	assert.Equal(t, "connecting to postgres://admin:<redacted>@db:5432/app", Redact("connecting to postgres://admin:s3cret@db:5432/app"))
+	assert.Equal(t, "mail sent to <redacted-email>", Redact("mail sent to jane.doe@example.com"))
+	assert.Equal(t, "token <redacted-jwt>", Redact("token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.abc"))
+}
@@ -0,0 +1,269 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/logging/logadmin"
+	kapkube "github.com/kapetacom/insight-api/kubernetes"
+	"google.golang.org/api/iterator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Query describes which log entries to read from a Source
+type Query struct {
+	// Instance is the block id, an empty instance matches all blocks
+	Instance string
+	// Deployment is the "<handle>-<name>" label used by the GCP backend
+	Deployment string
+	// Pod restricts the query to a single pod of the instance
+	Pod string
+	// Entity restricts the query to entries with this entity, which is
+	// the pod name for kubernetes and the container name for GCP
+	Entity string
+	// Severity restricts the query to entries of at least this severity for GCP, the kubernetes
+	// backend doesn't know the severity of a line and matches it with LogEntry.HasSeverity
+	Severity string
+	Since    time.Time
+	Until    time.Time
+	// Head is the number of oldest lines to return, 0 means all.
+	// Use Limits.TailLines to get the most recent lines instead.
+	Head   int64
+	Limits LogLimits
+}
+
+// Source reads log entries from one of the log backends
+type Source interface {
+	// Entries returns the entries matching the query sorted by timestamp, oldest first.
+	// The returned bool is true if the result was cut short by the query limits.
+	Entries(ctx context.Context, q Query) ([]*LogEntry, bool, error)
+}
+
+// NewSource returns the log backend for the runtime mode
+func NewSource(mode string) Source {
+	if mode == "kubernetes-only" {
+		return &kubernetesSource{namespace: "services", container: "main"}
+	}
+	return &gcpSource{}
+}
+
+type kubernetesSource struct {
+	namespace string
+	container string
+}
+
+func (s *kubernetesSource) Entries(ctx context.Context, q Query) ([]*LogEntry, bool, error) {
+	clientset, err := kapkube.KubernetesClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting kubernetes client: %v", err)
+	}
+	selector := "kapeta.com/block-id"
+	if q.Instance != "" {
+		selector += "=" + q.Instance
+	}
+	podList, err := clientset.CoreV1().Pods(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting pods: %v", err)
+	}
+
+	// with an upper bound the kubelet can't give us the tail, so the last lines up to it are kept
+	// while reading and the limits are only spent on the lines that are returned
+	tail := q.Limits.TailLines > 0 && !q.Until.IsZero()
+	budget := newLogBudget(q.Limits)
+	entries := make([]*LogEntry, 0)
+	// a pod that is being evicted or hasn't started yet has no logs, that shouldn't fail the others
+	var streamErr error
+	read := 0
+	for _, pod := range podList.Items {
+		if (q.Pod != "" && pod.Name != q.Pod) || (q.Entity != "" && pod.Name != q.Entity) {
+			continue
+		}
+		opts := &corev1.PodLogOptions{
+			Timestamps: true,
+			Container:  s.container,
+		}
+		if !q.Since.IsZero() {
+			opts.SinceTime = &metav1.Time{Time: q.Since}
+		}
+		if q.Limits.TailLines > 0 && !tail {
+			opts.TailLines = &q.Limits.TailLines
+		}
+		readCloser, err := clientset.CoreV1().Pods(s.namespace).GetLogs(pod.Name, opts).Stream(ctx)
+		if err != nil {
+			log.Printf("error opening stream to logs of pod %v: %v\n", pod.Name, err)
+			streamErr = err
+			continue
+		}
+		read++
+		lineReader := bufio.NewScanner(readCloser)
+		podEntries := make([]*LogEntry, 0)
+		for lineReader.Scan() {
+			logEntry := parseLogLine(pod.Name, lineReader.Text())
+			// SinceTime only has second precision
+			if !q.Since.IsZero() && logEntry.Timestamp < q.Since.UnixMilli() {
+				continue
+			}
+			if !q.Until.IsZero() && logEntry.Timestamp > q.Until.UnixMilli() {
+				break
+			}
+			// filtered before the limits, so other lines don't use up the budget
+			if q.Severity != "" && !logEntry.HasSeverity(q.Severity) {
+				continue
+			}
+			if tail {
+				if int64(len(podEntries)) == q.Limits.TailLines {
+					podEntries = podEntries[1:]
+				}
+				podEntries = append(podEntries, logEntry)
+				continue
+			}
+			if q.Head > 0 && int64(len(podEntries)) >= q.Head {
+				break
+			}
+			if !budget.take(logEntry) {
+				break
+			}
+			podEntries = append(podEntries, logEntry)
+		}
+		_ = readCloser.Close()
+		entries = append(entries, podEntries...)
+		if budget.truncated() {
+			break
+		}
+	}
+	if read == 0 && streamErr != nil {
+		return nil, false, fmt.Errorf("error opening stream to pod logs: %v", streamErr)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+	if q.Head > 0 && int64(len(entries)) > q.Head {
+		entries = entries[:q.Head]
+	}
+	if q.Limits.TailLines > 0 && int64(len(entries)) > q.Limits.TailLines {
+		entries = entries[int64(len(entries))-q.Limits.TailLines:]
+	}
+	if tail {
+		entries = budget.takeNewest(entries)
+	}
+	return entries, budget.truncated(), nil
+}
+
+type gcpSource struct{}
+
+func (s *gcpSource) Entries(ctx context.Context, q Query) ([]*LogEntry, bool, error) {
+	client, err := logClient(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer client.Close()
+
+	filter := gcpFilter(q.Instance, q.Deployment)
+	if q.Pod != "" {
+		filter += " resource.labels.pod_name=" + filterValue(q.Pod)
+	}
+	if q.Entity != "" {
+		filter += " resource.labels.container_name=" + filterValue(q.Entity)
+	}
+	if q.Severity != "" {
+		filter += " " + severityFilter(q.Severity)
+	}
+	if !q.Since.IsZero() {
+		filter += " timestamp>=\"" + q.Since.UTC().Format(time.RFC3339Nano) + "\""
+	}
+	if !q.Until.IsZero() {
+		filter += " timestamp<=\"" + q.Until.UTC().Format(time.RFC3339Nano) + "\""
+	}
+
+	opts := []logadmin.EntriesOption{logadmin.Filter(filter)}
+	if q.Head == 0 {
+		opts = append(opts, logadmin.NewestFirst())
+	}
+	it := client.Entries(ctx, opts...)
+	budget := newLogBudget(q.Limits)
+	entries := make([]*LogEntry, 0)
+	for {
+		gcpLogEntry, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get logs: %v", err)
+		}
+		if q.Limits.TailLines > 0 && int64(len(entries)) >= q.Limits.TailLines {
+			break
+		}
+		if q.Head > 0 && int64(len(entries)) >= q.Head {
+			break
+		}
+		logEntry := toLogEntry(gcpLogEntry)
+		if !budget.take(logEntry) {
+			break
+		}
+		entries = append(entries, logEntry)
+	}
+
+	// unless we want the head the entries are read newest first so the limits keep the most recent ones
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+	return entries, budget.truncated(), nil
+}
+
+// gcpFilter returns the Cloud Logging filter for the containers of an instance in a deployment
+func gcpFilter(instanceId string, deployment string) string {
+	filter := ""
+	if instanceId != "" {
+		filter += "labels.\"k8s-pod/instance\"=" + filterValue(instanceId) + " "
+	}
+	if deployment != "" {
+		filter += "labels.\"k8s-pod/deployment\"=" + filterValue(deployment) + " "
+	}
+	return filter + "resource.type=\"k8s_container\""
+}
+
+// severityFilter matches the entries of at least the severity, an unknown severity is the lowest
+func severityFilter(severity string) string {
+	return "severity>=" + strings.ToUpper(logging.ParseSeverity(severity).String())
+}
+
+// filterValue quotes a value for a Cloud Logging filter so it can't end the string
+func filterValue(value string) string {
+	return "\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + "\""
+}
+
+// validateTarget checks that the pod and entity of a query are kubernetes names
+func validateTarget(pod string, entity string) error {
+	for _, name := range []string{pod, entity} {
+		if name != "" && len(validation.IsDNS1123Subdomain(name)) > 0 {
+			return fmt.Errorf("invalid pod or entity name %q", name)
+		}
+	}
+	return nil
+}
+
+func toLogEntry(gcpLogEntry *logging.Entry) *LogEntry {
+	return &LogEntry{
+		Entity:    gcpLogEntry.Resource.Labels["container_name"],
+		Timestamp: gcpLogEntry.Timestamp.UnixMilli(),
+		Severity:  strings.ToUpper(gcpLogEntry.Severity.String()),
+		Message:   fmt.Sprintf("%v", gcpLogEntry.Payload),
+	}
+}
+
+// DeploymentLabel converts a kapeta deployment name "<handle>/<name>" to the label
+// value used on the pods, in labels "/" is not allowed - so it's seperated by "-" instead
+func DeploymentLabel(name string) string {
+	return strings.ReplaceAll(name, "/", "-")
+}
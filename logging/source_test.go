@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGcpFilter(t *testing.T) {
+	assert.Equal(t, `labels."k8s-pod/instance"="todo" resource.type="k8s_container"`, gcpFilter("todo", ""))
+	assert.Equal(t, `labels."k8s-pod/instance"="a\" OR \"b" resource.type="k8s_container"`, gcpFilter(`a" OR "b`, ""))
+	assert.Equal(t, `"a\\\"b"`, filterValue(`a\"b`))
+	assert.Equal(t, `severity>=ERROR`, severityFilter("error"))
+	assert.Equal(t, `severity>=DEFAULT`, severityFilter("verbose"))
+}
+
+func TestValidateTarget(t *testing.T) {
+	assert.NoError(t, validateTarget("todo-5d8f9c7b6-x2k4p", ""))
+	assert.NoError(t, validateTarget("", "main"))
+	assert.Error(t, validateTarget(`todo" OR resource.type="gce_instance`, ""))
+	assert.Error(t, validateTarget("", "Main"))
+}
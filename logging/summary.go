@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kapetacom/insight-api/jwt"
+	"github.com/kapetacom/insight-api/scopes"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultSummaryWindow = time.Hour
+
+// LogSummary groups the log entries of an instance within a time window by template
+type LogSummary struct {
+	From      int64              `json:"from"`
+	To        int64              `json:"to"`
+	Total     int                `json:"total"`
+	Truncated bool               `json:"truncated"`
+	Templates []*TemplateSummary `json:"templates"`
+}
+
+// LogSummaryHandler returns the most frequent log templates of an instance, use
+// the severity query parameter to get e.g. the top errors
+func LogSummaryHandler(mode string) echo.HandlerFunc {
+	source := NewSource(mode)
+	return func(c echo.Context) error {
+		instanceId := c.Param("instance")
+		deploymentHandle := c.Param("deploymentHandle")
+		deploymentName := c.Param("deploymentName")
+
+		if !jwt.HasScopeForHandle(c, deploymentHandle, scopes.LOGGING_READ_SCOPE) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("user does not have access to this deployment, missing scope %v for %v", scopes.LOGGING_READ_SCOPE, deploymentHandle))
+		}
+
+		from, to, err := requestWindow(c, defaultSummaryWindow)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		limits, err := requestLimits(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		top := 0
+		if v := c.QueryParam("top"); v != "" {
+			top, err = strconv.Atoi(v)
+			if err != nil || top <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid top %q", v))
+			}
+		}
+
+		entries, truncated, err := source.Entries(c.Request().Context(), Query{
+			Instance:   instanceId,
+			Deployment: deploymentHandle + "-" + deploymentName,
+			Severity:   c.QueryParam("severity"),
+			Since:      from,
+			Until:      to,
+			Limits:     limits,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get logs: %v", err))
+		}
+
+		templates := Summarize(entries)
+		if top > 0 && len(templates) > top {
+			templates = templates[:top]
+		}
+		return c.JSON(http.StatusOK, LogSummary{
+			From:      from.UnixMilli(),
+			To:        to.UnixMilli(),
+			Total:     len(entries),
+			Truncated: truncated,
+			Templates: templates,
+		})
+	}
+}
+
+// requestWindow returns the time window of the request, either given by the from and to
+// query parameters in unix milliseconds or by a window duration ending now
+func requestWindow(c echo.Context, defaultWindow time.Duration) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to %q", v)
+		}
+		to = time.UnixMilli(ms)
+	}
+	from := to.Add(-defaultWindow)
+	if v := c.QueryParam("window"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid window %q", v)
+		}
+		from = to.Add(-window)
+	}
+	if v := c.QueryParam("from"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from %q", v)
+		}
+		from = time.UnixMilli(ms)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
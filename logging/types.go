@@ -1,8 +1,20 @@
 package logging
 
+import "strings"
+
 type LogEntry struct {
 	Entity    string `json:"entity"`
 	Timestamp int64  `json:"timestamp"`
 	Severity  string `json:"severity"`
 	Message   string `json:"message"`
 }
+
+// HasSeverity returns true if the entry has the given severity, the kubernetes backend
+// doesn't know the severity of a line so the message itself is checked as well
+func (e *LogEntry) HasSeverity(severity string) bool {
+	severity = strings.ToUpper(severity)
+	if e.Severity == severity {
+		return true
+	}
+	return strings.Contains(strings.ToUpper(e.Message), severity)
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kapetacom/insight-api/alerts"
 	"github.com/kapetacom/insight-api/handlers"
+	"github.com/kapetacom/insight-api/history"
 	kapetajwt "github.com/kapetacom/insight-api/jwt"
 	"github.com/kapetacom/insight-api/logging"
 	"github.com/kapetacom/insight-api/middleware"
+	"github.com/kapetacom/insight-api/status"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	mw "github.com/labstack/echo/v4/middleware"
@@ -46,21 +52,79 @@ func main() {
 		return c.String(http.StatusOK, "OK!")
 	})
 
+	mode := os.Getenv("KAPETA_RUNTIME_MODE")
+	if mode == "" {
+		mode = "kubernetes-only"
+	}
+
+	// Signed share links are verified by their signature instead of a JWT
+	signer := logging.NewLinkSigner(os.Getenv("SHARE_LINK_SECRET"))
+	e.GET("/shared/logs", logging.SharedLogHandler(mode, signer))
+
 	// Create a restricted group of routes that requires a valid JWT
 	v1 := e.Group("/v1")
 	v1.Use(echojwt.WithConfig(config))
 	v1.Use(middleware.Restricted())
 
-	mode := os.Getenv("KAPETA_RUNTIME_MODE")
-	if mode == "" {
-		mode = "kubernetes-only"
-	}
 	// The :handle and :environment aren't really used in this route, but they are required to match the API of the local cluster service
 	v1.GET("/instances/:deploymentHandle/:deploymentName/:instance/logs", logging.LogHandler(mode))
+	v1.GET("/instances/:deploymentHandle/:deploymentName/:instance/logs/summary", logging.LogSummaryHandler(mode))
+	v1.GET("/instances/:deploymentHandle/:deploymentName/:instance/logs/context", logging.LogContextHandler(mode))
+	v1.POST("/instances/:deploymentHandle/:deploymentName/:instance/logs/share", logging.CreateShareLink(signer))
 
 	v1.GET("/instances/:instance", logging.LogByInstanceID)
 	v1.GET("/instances/name/:name", logging.LogByInstanceName)
-	v1.GET("/status", handlers.GetEnvironmentStatus(mode))
+	v1.GET("/instances/:instance/pods", handlers.GetInstancePods)
+
+	statusCache, err := status.NewCache(mode)
+	if err != nil {
+		log.Fatalf("error creating status cache: %v", err)
+	}
+	statusCache.Start(context.Background())
+	v1.GET("/status", handlers.GetEnvironmentStatus(statusCache))
+	v1.GET("/status/drift", handlers.GetDrift(statusCache))
+	v1.GET("/status/topology", handlers.GetTopology(statusCache))
+	v1.GET("/status/signals", handlers.GetSignals(statusCache))
+	v1.GET("/instances/:instance/resources", handlers.GetInstanceResources(statusCache))
+	v1.GET("/instances/:instance/health", handlers.GetInstanceHealth(statusCache))
+	v1.GET("/instances/:instance/autoscaler", handlers.GetInstanceAutoscaler(statusCache))
+	v1.GET("/status/versions", handlers.GetEnvironmentVersions(statusCache))
+	v1.GET("/status/versions/diff", handlers.GetVersionDiff(statusCache))
+
+	broadcaster := status.NewBroadcaster(statusCache, 15*time.Second)
+	broadcaster.Start(context.Background())
+	v1.GET("/status/watch", handlers.WatchEnvironmentStatus(broadcaster))
+	v1.GET("/status/rollout", handlers.GetRollout(statusCache))
+	v1.GET("/status/rollout/watch", handlers.WatchRollout(statusCache, broadcaster))
+
+	historyStore, err := history.NewStore()
+	if err != nil {
+		log.Fatalf("error creating state history store: %v", err)
+	}
+	retention, err := time.ParseDuration(os.Getenv("STATE_HISTORY_RETENTION"))
+	if err != nil || retention <= 0 {
+		// long enough for the monthly availability reports
+		retention = 30 * 24 * time.Hour
+	}
+	maxEntries, err := strconv.Atoi(os.Getenv("STATE_HISTORY_MAX_ENTRIES"))
+	if err != nil || maxEntries <= 0 {
+		// keeps the history well below the 1MiB limit of a ConfigMap
+		maxEntries = 2000
+	}
+	recorder := history.NewRecorder(broadcaster, historyStore, retention, maxEntries)
+	recorder.Start(context.Background())
+	v1.GET("/status/timeline", handlers.GetStateTimeline(recorder))
+	v1.GET("/status/availability", handlers.GetAvailability(recorder))
+	v1.GET("/gateways", handlers.GetGateways(statusCache))
+
+	alertInterval, err := time.ParseDuration(os.Getenv("ALERT_EVALUATION_INTERVAL"))
+	if err != nil || alertInterval <= 0 {
+		alertInterval = time.Minute
+	}
+	evaluator := alerts.NewEvaluator(mode, alertInterval)
+	evaluator.Start(context.Background())
+	v1.GET("/alerts/rules", alerts.ListRules(evaluator))
+
 	// Start the service and log if the server fails to start/crashes
 	e.Logger.Fatal(e.Start(":1323"))
 }
@@ -1,5 +1,7 @@
 package model
 
+import "encoding/json"
+
 type ClusterStatus struct {
 	Instances          []InstanceState `json:"instanceStates"`
 	Operators          []OperatorState `json:"operatorStates"`
@@ -9,22 +11,390 @@ type ClusterStatus struct {
 	PlanVersion        string          `json:"planVersion"`
 	TargetName         string          `json:"targetName"`
 	TargetVersion      string          `json:"targetVersion"`
+	// UpdatedAt is the time in unix milliseconds of the oldest data the status was built from
+	UpdatedAt int64 `json:"updatedAt"`
 }
 
+// The states an instance can be in
+const (
+	StateReady          = "Ready"
+	StateProgressing    = "Progressing"
+	StateDegraded       = "Degraded"
+	StateCrashLooping   = "CrashLooping"
+	StateImagePullError = "ImagePullError"
+	StatePending        = "Pending"
+	StateScaledToZero   = "ScaledToZero"
+	StateFailed         = "Failed"
+	StateRunning        = "Running"
+	StateCompleted      = "Completed"
+	StateSuspended      = "Suspended"
+)
+
+// The types of instances
+const (
+	TypeBlock       = "block"
+	TypeGateway     = "gateway"
+	TypeStatefulSet = "statefulset"
+	TypeDaemonSet   = "daemonset"
+	TypeJob         = "job"
+	TypeCronJob     = "cronjob"
+)
+
 type InstanceState struct {
 	Name            string            `json:"name"`
 	BlockID         string            `json:"instanceId"`
 	State           string            `json:"state"`
+	Reason          string            `json:"reason,omitempty"`
+	Message         string            `json:"message,omitempty"`
 	Metadata        map[string]string `json:"metadata"`
 	ReadyReplicas   int32             `json:"readyReplicas"`
 	DesiredReplicas int32             `json:"desiredReplicas"`
 	Type            string            `json:"type"`
+	// Autoscaler is the HorizontalPodAutoscaler scaling the instance, if any
+	Autoscaler *AutoscalerState `json:"autoscaler,omitempty"`
+}
+
+// AutoscalerState is the state of a HorizontalPodAutoscaler, the desired replicas of the
+// instance follow the autoscaler so they change without a deployment
+type AutoscalerState struct {
+	Name            string             `json:"name"`
+	MinReplicas     int32              `json:"minReplicas"`
+	MaxReplicas     int32              `json:"maxReplicas"`
+	CurrentReplicas int32              `json:"currentReplicas"`
+	DesiredReplicas int32              `json:"desiredReplicas"`
+	Metrics         []AutoscalerMetric `json:"metrics"`
+	// ScalingLimited is true when the desired replicas were capped by the min or max replicas
+	ScalingLimited bool `json:"scalingLimited"`
+	// Reason and Message explain why the autoscaler is limited or can't scale
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// LastScaleTime is the time in unix milliseconds the autoscaler last changed the replicas
+	LastScaleTime int64 `json:"lastScaleTime,omitempty"`
+}
+
+// AutoscalerMetric is a metric the autoscaler scales on, the values are percentages for
+// utilization targets and quantities otherwise. Current is only reported by the autoscaler
+// of a single instance, not in the status.
+type AutoscalerMetric struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Target  string `json:"target"`
+	Current string `json:"current,omitempty"`
 }
 
 type OperatorState struct {
 	ID    string `json:"id"`
 	Name  string `json:"name"`
 	State string `json:"state"`
+	// Volumes are the persistent volume claims the database stores its data on
+	Volumes []VolumeState `json:"volumes,omitempty"`
+}
+
+// VolumeState is the state of a persistent volume claim, usage is only known when the
+// kubelet volume stats could be read
+type VolumeState struct {
+	Name          string `json:"name"`
+	Phase         string `json:"phase"`
+	StorageClass  string `json:"storageClass,omitempty"`
+	CapacityBytes int64  `json:"capacityBytes"`
+	// UsagePercentage is rounded down to steps of 5 so it doesn't change with every write
+	UsagePercentage *float64 `json:"usagePercentage,omitempty"`
+	// Reason and Message are set when the volume needs attention, e.g. it is almost full
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// StateTransition is a change of state of an instance, gateway or operator
+type StateTransition struct {
+	// Timestamp is the time in unix milliseconds the change was observed
+	Timestamp int64 `json:"timestamp"`
+	// Type is the instance type, or "operator" for operators
+	Type string `json:"type"`
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	// Provider tells gateways with the same name apart, e.g. an Ingress and an HTTPRoute
+	Provider string `json:"provider,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Availability of an instance, operator or the whole environment within a report window,
+// durations are in milliseconds
+type Availability struct {
+	Type     string `json:"type,omitempty"`
+	Name     string `json:"name,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	// Percentage of the measured time the instance was available, omitted when nothing was measured
+	Percentage *float64 `json:"percentage,omitempty"`
+	// Measured is the part of the window the state was known
+	Measured  int64 `json:"measured"`
+	Uptime    int64 `json:"uptime"`
+	Downtime  int64 `json:"downtime"`
+	Incidents int   `json:"incidents"`
+	// MTTR is the mean time to recovery of the incidents that recovered
+	MTTR int64 `json:"mttr"`
+	// Ongoing is true if the instance is unavailable at the end of the window
+	Ongoing bool `json:"ongoing"`
+}
+
+type AvailabilityReport struct {
+	Window      string         `json:"window"`
+	From        int64          `json:"from"`
+	To          int64          `json:"to"`
+	Environment Availability   `json:"environment"`
+	Instances   []Availability `json:"instances"`
+}
+
+// GatewayInfo describes an ingress gateway, its state is degraded while a certificate
+// is about to expire and failed once one has expired or can't be read
+type GatewayInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	State     string            `json:"state"`
+	Reason    string            `json:"reason,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Servers   []GatewayServer   `json:"servers"`
+}
+
+type GatewayServer struct {
+	Name           string           `json:"name,omitempty"`
+	Port           uint32           `json:"port"`
+	Protocol       string           `json:"protocol"`
+	Hosts          []string         `json:"hosts"`
+	TLSMode        string           `json:"tlsMode,omitempty"`
+	CredentialName string           `json:"credentialName,omitempty"`
+	Certificate    *CertificateInfo `json:"certificate,omitempty"`
+	Error          string           `json:"error,omitempty"`
+}
+
+type CertificateInfo struct {
+	Subject  string   `json:"subject"`
+	Issuer   string   `json:"issuer"`
+	DNSNames []string `json:"dnsNames"`
+	// NotBefore and NotAfter are in unix milliseconds
+	NotBefore       int64 `json:"notBefore"`
+	NotAfter        int64 `json:"notAfter"`
+	DaysUntilExpiry int   `json:"daysUntilExpiry"`
+	Expired         bool  `json:"expired"`
+}
+
+// EnvironmentVersion is a version of the environment stored in the cluster
+type EnvironmentVersion struct {
+	EnvironmentName    string `json:"environmentName"`
+	EnvironmentVersion string `json:"environmentVersion"`
+	PlanName           string `json:"planName"`
+	PlanVersion        string `json:"planVersion"`
+	TargetName         string `json:"targetName"`
+	TargetVersion      string `json:"targetVersion"`
+	// CreatedAt is the time in unix milliseconds the version was stored
+	CreatedAt int64 `json:"createdAt"`
+	// Current is true for the newest version, the one the status is built from
+	Current bool `json:"current"`
+}
+
+// ServiceChange is a block or operator service that differs between two versions
+type ServiceChange struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	FromRef   string `json:"fromRef,omitempty"`
+	ToRef     string `json:"toRef,omitempty"`
+	FromImage string `json:"fromImage,omitempty"`
+	ToImage   string `json:"toImage,omitempty"`
+	// Configuration lists the configuration keys that were added, removed or changed, values are left out
+	// as they can hold credentials
+	Configuration []string `json:"configuration,omitempty"`
+}
+
+// VersionDiff is the difference between the deployment descriptors of two environment versions
+type VersionDiff struct {
+	EnvironmentName string          `json:"environmentName"`
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	Added           []ServiceChange `json:"added"`
+	Removed         []ServiceChange `json:"removed"`
+	Changed         []ServiceChange `json:"changed"`
+	// Configuration lists the changed keys of the environment configuration
+	Configuration []string `json:"configuration"`
+}
+
+// RolloutProgress is the progress of the blocks towards the current environment version
+type RolloutProgress struct {
+	EnvironmentName    string `json:"environmentName"`
+	EnvironmentVersion string `json:"environmentVersion"`
+	// StartedAt is the time in unix milliseconds the environment version was stored
+	StartedAt      int64          `json:"startedAt"`
+	ElapsedSeconds int64          `json:"elapsedSeconds"`
+	Complete       bool           `json:"complete"`
+	Stalled        bool           `json:"stalled"`
+	Blocks         []BlockRollout `json:"blocks"`
+}
+
+// BlockRollout is the progress of the pods of a block towards its newest ReplicaSet
+type BlockRollout struct {
+	Name       string `json:"name"`
+	BlockID    string `json:"instanceId"`
+	ReplicaSet string `json:"replicaSet,omitempty"`
+	Revision   string `json:"revision,omitempty"`
+	Desired    int32  `json:"desired"`
+	Updated    int32  `json:"updated"`
+	Ready      int32  `json:"ready"`
+	Available  int32  `json:"available"`
+	// StartedAt is the time in unix milliseconds the newest ReplicaSet was created
+	StartedAt      int64  `json:"startedAt"`
+	ElapsedSeconds int64  `json:"elapsedSeconds"`
+	Complete       bool   `json:"complete"`
+	Stalled        bool   `json:"stalled"`
+	Reason         string `json:"reason,omitempty"`
+	Message        string `json:"message,omitempty"`
+}
+
+// The types of topology nodes
+const (
+	NodeBlock    = "block"
+	NodeGateway  = "gateway"
+	NodeOperator = "operator"
+)
+
+// Topology is the graph of the blocks, gateways and operators of the environment and the
+// connections between them
+type Topology struct {
+	EnvironmentName    string         `json:"environmentName"`
+	EnvironmentVersion string         `json:"environmentVersion"`
+	Nodes              []TopologyNode `json:"nodes"`
+	Edges              []TopologyEdge `json:"edges"`
+}
+
+// TopologyNode is a service of the deployment with the live state of its instances, the
+// state is the worst state of the instances
+type TopologyNode struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Kind      string          `json:"kind,omitempty"`
+	Ref       string          `json:"ref,omitempty"`
+	State     string          `json:"state"`
+	Reason    string          `json:"reason,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Healthy   bool            `json:"healthy"`
+	Instances []InstanceState `json:"instances"`
+}
+
+// TopologyEdge is a connection from a consumer to the provider it depends on
+type TopologyEdge struct {
+	Source         string `json:"source"`
+	Target         string `json:"target"`
+	SourceResource string `json:"sourceResource,omitempty"`
+	TargetResource string `json:"targetResource,omitempty"`
+	Type           string `json:"type"`
+	PortType       string `json:"portType,omitempty"`
+	// Healthy is false when the provider is unhealthy, the consumer is likely affected by it
+	Healthy bool `json:"healthy"`
+}
+
+// ResourceMetric is the usage of cpu in millicores or memory in bytes compared to the requests
+// and limits, the percentages are left out when no request or limit is set
+type ResourceMetric struct {
+	Usage             int64    `json:"usage"`
+	Request           int64    `json:"request"`
+	Limit             int64    `json:"limit"`
+	RequestPercentage *float64 `json:"requestPercentage,omitempty"`
+	LimitPercentage   *float64 `json:"limitPercentage,omitempty"`
+}
+
+// ContainerResources is unmeasured until metrics-server has reported the container
+type ContainerResources struct {
+	Name            string         `json:"name"`
+	Measured        bool           `json:"measured"`
+	CPU             ResourceMetric `json:"cpu"`
+	Memory          ResourceMetric `json:"memory"`
+	NearMemoryLimit bool           `json:"nearMemoryLimit"`
+}
+
+// PodResources is only measured when all of its containers are, unmeasured pods are left
+// out of the totals of the instance
+type PodResources struct {
+	Name       string               `json:"name"`
+	Measured   bool                 `json:"measured"`
+	CPU        ResourceMetric       `json:"cpu"`
+	Memory     ResourceMetric       `json:"memory"`
+	Containers []ContainerResources `json:"containers"`
+}
+
+// InstanceResources is the cpu and memory usage of the pods of an instance, usage is only known
+// when metrics-server is installed, otherwise only the requests and limits are reported
+type InstanceResources struct {
+	BlockID         string         `json:"instanceId"`
+	MetricsEnabled  bool           `json:"metricsEnabled"`
+	CPU             ResourceMetric `json:"cpu"`
+	Memory          ResourceMetric `json:"memory"`
+	NearMemoryLimit bool           `json:"nearMemoryLimit"`
+	Pods            []PodResources `json:"pods"`
+	// UpdatedAt is the time in unix milliseconds of the metrics
+	UpdatedAt int64 `json:"updatedAt,omitempty"`
+}
+
+// HealthCheck is the last call to the health endpoint of a block, the status only reports the
+// health itself as the latency changes with every call
+type HealthCheck struct {
+	BlockID string `json:"instanceId"`
+	Health  string `json:"health"`
+	// Latency is in milliseconds
+	Latency int64 `json:"latency"`
+	// CheckedAt is the time in unix milliseconds of the call
+	CheckedAt    int64           `json:"checkedAt"`
+	Error        string          `json:"error,omitempty"`
+	Dependencies json.RawMessage `json:"dependencies,omitempty"`
+}
+
+// GoldenSignals is the traffic of a block or gateway route over a window, the latencies are
+// in milliseconds and left out when there was no traffic
+type GoldenSignals struct {
+	// RequestRate is in requests per second
+	RequestRate float64 `json:"requestRate"`
+	// ErrorRate is the share of 5xx responses between 0 and 1
+	ErrorRate  float64  `json:"errorRate"`
+	LatencyP50 *float64 `json:"latencyP50,omitempty"`
+	LatencyP95 *float64 `json:"latencyP95,omitempty"`
+	LatencyP99 *float64 `json:"latencyP99,omitempty"`
+}
+
+// SignalsReport has the golden signals of the blocks by block id and of the gateway routes
+// by type/provider/name
+type SignalsReport struct {
+	Window   string                   `json:"window"`
+	Blocks   map[string]GoldenSignals `json:"blocks"`
+	Gateways map[string]GoldenSignals `json:"gateways"`
+}
+
+// The kinds of drift between the plan and the cluster
+const (
+	DriftMissingFromCluster      = "MissingFromCluster"
+	DriftNotInPlan               = "NotInPlan"
+	DriftImageMismatch           = "ImageMismatch"
+	DriftVersionMismatch         = "VersionMismatch"
+	DriftMissingOperatorResource = "MissingOperatorResource"
+)
+
+// DriftItem is a difference between the deployment descriptor and what is running
+type DriftItem struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+type DriftReport struct {
+	EnvironmentName    string      `json:"environmentName"`
+	EnvironmentVersion string      `json:"environmentVersion"`
+	InSync             bool        `json:"inSync"`
+	Drift              []DriftItem `json:"drift"`
 }
 
 type TraefikRoutes []struct {
@@ -60,3 +430,29 @@ type LoadBalancer struct {
 	Servers        []Servers `json:"servers"`
 	PassHostHeader bool      `json:"passHostHeader"`
 }
+
+// PodState is the detailed state of a single pod of an instance
+type PodState struct {
+	Name         string           `json:"name"`
+	Phase        string           `json:"phase"`
+	Ready        bool             `json:"ready"`
+	RestartCount int32            `json:"restartCount"`
+	Node         string           `json:"node"`
+	StartTime    int64            `json:"startTime,omitempty"`
+	Containers   []ContainerState `json:"containers"`
+	// ProbeFailures are the latest liveness, readiness and startup probe failure messages
+	ProbeFailures []string `json:"probeFailures,omitempty"`
+}
+
+type ContainerState struct {
+	Name                  string `json:"name"`
+	Image                 string `json:"image"`
+	ImageDigest           string `json:"imageDigest,omitempty"`
+	Ready                 bool   `json:"ready"`
+	RestartCount          int32  `json:"restartCount"`
+	State                 string `json:"state"`
+	Reason                string `json:"reason,omitempty"`
+	Message               string `json:"message,omitempty"`
+	LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+	LastExitCode          *int32 `json:"lastExitCode,omitempty"`
+}
@@ -0,0 +1,80 @@
+package gcp
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// CloudSQLView keeps a copy of the Cloud SQL instances of the project, refreshed in the
+// background so that the status doesn't call the Cloud SQL Admin API on every request
+type CloudSQLView struct {
+	interval time.Duration
+
+	mu        sync.RWMutex
+	instances []*sqladmin.DatabaseInstance
+	updated   time.Time
+	err       error
+}
+
+func NewCloudSQLView(interval time.Duration) *CloudSQLView {
+	return &CloudSQLView{interval: interval}
+}
+
+// Start refreshes the view every interval until the context is cancelled
+func (v *CloudSQLView) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+		for {
+			v.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (v *CloudSQLView) refresh(ctx context.Context) {
+	instances, err := listInstances(ctx)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err != nil {
+		log.Printf("error refreshing Cloud SQL instances: %v\n", err)
+		v.err = err
+		return
+	}
+	v.instances = instances
+	v.updated = time.Now()
+	v.err = nil
+}
+
+// Instances returns the cached instances and when they were fetched
+func (v *CloudSQLView) Instances() ([]*sqladmin.DatabaseInstance, time.Time, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.instances, v.updated, v.err
+}
+
+func listInstances(ctx context.Context) ([]*sqladmin.DatabaseInstance, error) {
+	projectID, err := metadata.ProjectID()
+	if err != nil {
+		return nil, err
+	}
+	sqlService, err := sqladmin.NewService(ctx, option.WithScopes())
+	if err != nil {
+		return nil, err
+	}
+	list, err := sqlService.Instances.List(projectID).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -1,68 +1,47 @@
 package gcp
 
 import (
-	"context"
-	"fmt"
 	"log"
 	"strings"
 
-	"cloud.google.com/go/compute/metadata"
-	"github.com/kapetacom/insight-api/kubernetes"
 	"github.com/kapetacom/insight-api/model"
-	"google.golang.org/api/option"
+	"github.com/kapetacom/insight-api/operators/local"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
 	"google.golang.org/api/sqladmin/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	kube "k8s.io/client-go/kubernetes"
+	appsv1 "k8s.io/api/apps/v1"
 )
 
-func GetDatabaseState(ctx context.Context, clientset *kube.Clientset) ([]model.OperatorState, error) {
-
-	deployment, err := kubernetes.GetDeployment(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	projectID, err := metadata.ProjectID()
+// GetDatabaseState returns the state of the databases of the deployment, postgres is
+// running in Cloud SQL while mongodb is a deployment in the infrastructure namespace
+func GetDatabaseState(deployment *kapetamodel.Deployment, infrastructure []*appsv1.Deployment, cloudSQL *CloudSQLView) []model.OperatorState {
+	states := []model.OperatorState{}
+	instances, updated, err := cloudSQL.Instances()
 	if err != nil {
-		return nil, err
+		log.Printf("Cloud SQL instances are unavailable: %v\n", err)
 	}
 
-	states := []model.OperatorState{}
-
 	for _, svc := range deployment.Spec.Services {
 		switch svc.Kind {
 		case "kapeta/resource-type-postgresql":
-			states = append(states, getPostgresState(ctx, deployment.Metadata.Name, svc.Id, projectID))
+			states = append(states, getPostgresState(deployment.Metadata.Name, svc.Id, instances, !updated.IsZero()))
 		case "kapeta/resource-type-mongodb":
-			states = append(states, getMongoDBState(ctx, svc.Id))
+			states = append(states, getMongoDBState(svc.Id, infrastructure))
 		}
 	}
 
-	return states, nil
+	return states
 }
 
-func getMongoDBState(ctx context.Context, id string) model.OperatorState {
+func getMongoDBState(id string, infrastructure []*appsv1.Deployment) model.OperatorState {
 	state := model.OperatorState{
 		ID:    id,
 		State: "Failed",
 	}
-	clientset, err := kubernetes.KubernetesClient()
-	if err != nil {
-		log.Printf("error getting kubernetes client: %v\n", err)
-		return state
-	}
-	podList, err := clientset.AppsV1().Deployments("infrastructure").List(ctx, metav1.ListOptions{
-		LabelSelector: "kapeta.com/block-id=" + id,
-	})
-	if err != nil {
-		log.Printf("error getting pods: %v\n", err)
-		return state
-	}
-	if len(podList.Items) == 0 {
-		log.Printf("no pods found with label kapeta.com/block-id=%s\n", id)
+	mongoDeployment := local.FindByBlockID(infrastructure, id) //TODO: More than one pod?
+	if mongoDeployment == nil {
+		log.Printf("no deployments found with label kapeta.com/block-id=%s\n", id)
 		return state
 	}
-	mongoDeployment := podList.Items[0] //TODO: More than one pod?
 	readyReplicas := mongoDeployment.Status.ReadyReplicas
 	desiredReplicas := *mongoDeployment.Spec.Replicas
 	if readyReplicas == desiredReplicas {
@@ -72,35 +51,69 @@ func getMongoDBState(ctx context.Context, id string) model.OperatorState {
 	return state
 }
 
-func getPostgresState(ctx context.Context, name string, id string, projectID string) model.OperatorState {
+// getPostgresState is Unknown for a database that isn't found before the instances have been loaded,
+// a project without instances has no instances either
+func getPostgresState(name string, id string, instances []*sqladmin.DatabaseInstance, loaded bool) model.OperatorState {
 	state := model.OperatorState{
 		ID:    id,
 		State: "Failed",
 	}
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes())
-	if err != nil {
+	dbName, handle, ok := postgresName(name, id)
+	if !ok {
 		return state
 	}
-	splitName := strings.Split(name, "/")
-	dbName := splitName[1] + "-" + id
-	handle := splitName[0]
-	log.Println("Trying to get status for CloudSQL database: ", dbName)
+	state.Name = dbName
 
-	// Retrieve the instance status
-	list, err := sqlService.Instances.List(projectID).Context(ctx).Do()
-	if err != nil {
+	if db := findPostgresInstance(dbName, handle, instances); db != nil {
+		state.State = stateMapper(db.State)
 		return state
 	}
-	for _, db := range list.Items {
+	if !loaded {
+		state.State = "Unknown"
+	}
+	return state
+}
+
+// HasBackingResource tells if the database service is backed by a Cloud SQL instance or a deployment in
+// the infrastructure namespace, known is false for kinds we don't manage or while Cloud SQL is unavailable
+func HasBackingResource(deployment *kapetamodel.Deployment, svc kapetamodel.DeploymentServiceInstance, infrastructure []*appsv1.Deployment, cloudSQL *CloudSQLView) (exists bool, known bool) {
+	switch svc.Kind {
+	case "kapeta/resource-type-postgresql":
+		instances, updated, err := cloudSQL.Instances()
+		if err != nil || updated.IsZero() {
+			return false, false
+		}
+		dbName, handle, ok := postgresName(deployment.Metadata.Name, svc.Id)
+		if !ok {
+			return false, false
+		}
+		return findPostgresInstance(dbName, handle, instances) != nil, true
+	case "kapeta/resource-type-mongodb":
+		return local.FindByBlockID(infrastructure, svc.Id) != nil, true
+	}
+	return false, false
+}
+
+// postgresName returns the name and handle the Cloud SQL instance of a service is labelled with
+func postgresName(deploymentName string, id string) (string, string, bool) {
+	splitName := strings.Split(deploymentName, "/")
+	if len(splitName) != 2 {
+		return "", "", false
+	}
+	return splitName[1] + "-" + id, splitName[0], true
+}
+
+func findPostgresInstance(dbName string, handle string, instances []*sqladmin.DatabaseInstance) *sqladmin.DatabaseInstance {
+	for _, db := range instances {
+		if db.Settings == nil {
+			continue
+		}
+		// there should only be one
 		if db.Settings.UserLabels["kapeta-deploymentname"] == dbName && db.Settings.UserLabels["kapeta-handle"] == handle {
-			state.State = stateMapper(db.State)
-			fmt.Printf("Instance status: %s\n", db.State)
-			// early return since there should only be one
-			return state
+			return db
 		}
 	}
-	state.Name = dbName
-	return state
+	return nil
 }
 
 func stateMapper(gcpState string) string {
@@ -1,58 +1,40 @@
 package local
 
 import (
-	"context"
 	"log"
 
-	"github.com/kapetacom/insight-api/kubernetes"
 	"github.com/kapetacom/insight-api/model"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	kube "k8s.io/client-go/kubernetes"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	appsv1 "k8s.io/api/apps/v1"
 )
 
-func GetDatabaseState(ctx context.Context, clientset *kube.Clientset) ([]model.OperatorState, error) {
-
-	deployment, err := kubernetes.GetDeployment(ctx)
-	if err != nil {
-		return nil, err
-	}
-
+// GetDatabaseState returns the state of the databases of the deployment, they are
+// all running as deployments in the infrastructure namespace
+func GetDatabaseState(deployment *kapetamodel.Deployment, infrastructure []*appsv1.Deployment) []model.OperatorState {
 	states := []model.OperatorState{}
 
 	for _, svc := range deployment.Spec.Services {
 		switch svc.Kind {
 		case "kapeta/resource-type-postgresql":
-			states = append(states, getLocalPostgresState(ctx, deployment.Metadata.Name, svc.Id, "CHANGE ME"))
+			states = append(states, getLocalPostgresState(svc.Id, infrastructure))
 		case "kapeta/resource-type-mongodb":
-			states = append(states, getMongoDBState(ctx, svc.Id))
+			states = append(states, getMongoDBState(svc.Id, infrastructure))
 		}
 	}
 
-	return states, nil
+	return states
 }
 
-func getLocalPostgresState(ctx context.Context, name string, id string, projectID string) model.OperatorState {
+func getLocalPostgresState(id string, infrastructure []*appsv1.Deployment) model.OperatorState {
 	state := model.OperatorState{
 		ID:    id,
 		State: "Failed",
 	}
-	clientset, err := kubernetes.KubernetesClient()
-	if err != nil {
-		log.Printf("error getting kubernetes client: %v\n", err)
-		return state
-	}
-	podList, err := clientset.AppsV1().Deployments("infrastructure").List(ctx, metav1.ListOptions{
-		LabelSelector: "kapeta.com/block-id=" + id,
-	})
-	if err != nil {
-		log.Printf("error getting pods: %v\n", err)
+	pgDeployment := FindByBlockID(infrastructure, id)
+	if pgDeployment == nil {
+		log.Printf("no deployments found with label kapeta.com/block-id=%s\n", id)
 		return state
 	}
-	if len(podList.Items) == 0 {
-		log.Printf("no pods found with label kapeta.com/block-id=%s\n", id)
-		return state
-	}
-	pgDeployment := podList.Items[0]
 	readyReplicas := pgDeployment.Status.ReadyReplicas
 	desiredReplicas := *pgDeployment.Spec.Replicas
 	if readyReplicas == desiredReplicas {
@@ -62,28 +44,16 @@ func getLocalPostgresState(ctx context.Context, name string, id string, projectI
 	return state
 }
 
-func getMongoDBState(ctx context.Context, id string) model.OperatorState {
+func getMongoDBState(id string, infrastructure []*appsv1.Deployment) model.OperatorState {
 	state := model.OperatorState{
 		ID:    id,
 		State: "Failed",
 	}
-	clientset, err := kubernetes.KubernetesClient()
-	if err != nil {
-		log.Printf("error getting kubernetes client: %v\n", err)
-		return state
-	}
-	podList, err := clientset.AppsV1().Deployments("infrastructure").List(ctx, metav1.ListOptions{
-		LabelSelector: "kapeta.com/block-id=" + id,
-	})
-	if err != nil {
-		log.Printf("error getting pods: %v\n", err)
+	mongoDeployment := FindByBlockID(infrastructure, id) //TODO: More than one pod?
+	if mongoDeployment == nil {
+		log.Printf("no deployments found with label kapeta.com/block-id=%s\n", id)
 		return state
 	}
-	if len(podList.Items) == 0 {
-		log.Printf("no pods found with label kapeta.com/block-id=%s\n", id)
-		return state
-	}
-	mongoDeployment := podList.Items[0] //TODO: More than one pod?
 	readyReplicas := mongoDeployment.Status.ReadyReplicas
 	desiredReplicas := *mongoDeployment.Spec.Replicas
 	if readyReplicas == desiredReplicas {
@@ -92,3 +62,23 @@ func getMongoDBState(ctx context.Context, id string) model.OperatorState {
 	state.Name = mongoDeployment.Name
 	return state
 }
+
+// HasBackingResource tells if the database service is backed by a deployment in the
+// infrastructure namespace, known is false for kinds we don't manage
+func HasBackingResource(svc kapetamodel.DeploymentServiceInstance, infrastructure []*appsv1.Deployment) (exists bool, known bool) {
+	switch svc.Kind {
+	case "kapeta/resource-type-postgresql", "kapeta/resource-type-mongodb":
+		return FindByBlockID(infrastructure, svc.Id) != nil, true
+	}
+	return false, false
+}
+
+// FindByBlockID returns the first deployment with the kapeta.com/block-id label set to id
+func FindByBlockID(deployments []*appsv1.Deployment, id string) *appsv1.Deployment {
+	for _, d := range deployments {
+		if d.GetLabels()["kapeta.com/block-id"] == id {
+			return d
+		}
+	}
+	return nil
+}
@@ -1,18 +1,28 @@
 package operators
 
 import (
-	"context"
-
 	"github.com/kapetacom/insight-api/model"
 	"github.com/kapetacom/insight-api/operators/gcp"
 	"github.com/kapetacom/insight-api/operators/local"
-	"k8s.io/client-go/kubernetes"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	appsv1 "k8s.io/api/apps/v1"
 )
 
-func GetDatabaseState(ctx context.Context, mode string, clientset *kubernetes.Clientset) ([]model.OperatorState, error) {
+// GetDatabaseState returns the state of the database services of the deployment,
+// infrastructure is the list of deployments in the infrastructure namespace
+func GetDatabaseState(mode string, deployment *kapetamodel.Deployment, infrastructure []*appsv1.Deployment, cloudSQL *gcp.CloudSQLView) []model.OperatorState {
 	if mode == "kubernetes-only" {
-		return local.GetDatabaseState(ctx, clientset)
+		return local.GetDatabaseState(deployment, infrastructure)
 	}
-	return gcp.GetDatabaseState(ctx, clientset)
+	return gcp.GetDatabaseState(deployment, infrastructure, cloudSQL)
+
+}
 
+// HasBackingResource tells if the operator service of the deployment has a database behind it,
+// known is false if that can't be determined
+func HasBackingResource(mode string, deployment *kapetamodel.Deployment, svc kapetamodel.DeploymentServiceInstance, infrastructure []*appsv1.Deployment, cloudSQL *gcp.CloudSQLView) (exists bool, known bool) {
+	if mode == "kubernetes-only" {
+		return local.HasBackingResource(svc, infrastructure)
+	}
+	return gcp.HasBackingResource(deployment, svc, infrastructure, cloudSQL)
 }
@@ -0,0 +1,150 @@
+package status
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// missing replicas right after the autoscaler scaled up are reported as scaling rather than degraded
+var scalingGracePeriod = 5 * time.Minute
+
+// AutoscalerState returns the state of the HorizontalPodAutoscaler
+func AutoscalerState(hpa *autoscalingv2.HorizontalPodAutoscaler) *model.AutoscalerState {
+	state := &model.AutoscalerState{
+		Name:            hpa.Name,
+		MinReplicas:     1,
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+		Metrics:         []model.AutoscalerMetric{},
+	}
+	if hpa.Spec.MinReplicas != nil {
+		state.MinReplicas = *hpa.Spec.MinReplicas
+	}
+	if hpa.Status.LastScaleTime != nil {
+		state.LastScaleTime = hpa.Status.LastScaleTime.UnixMilli()
+	}
+
+	for i, spec := range hpa.Spec.Metrics {
+		metric := model.AutoscalerMetric{Type: string(spec.Type)}
+		var target autoscalingv2.MetricTarget
+		switch {
+		case spec.Resource != nil:
+			metric.Name, target = string(spec.Resource.Name), spec.Resource.Target
+		case spec.ContainerResource != nil:
+			metric.Name, target = spec.ContainerResource.Container+"/"+string(spec.ContainerResource.Name), spec.ContainerResource.Target
+		case spec.Pods != nil:
+			metric.Name, target = spec.Pods.Metric.Name, spec.Pods.Target
+		case spec.Object != nil:
+			metric.Name, target = spec.Object.Metric.Name, spec.Object.Target
+		case spec.External != nil:
+			metric.Name, target = spec.External.Metric.Name, spec.External.Target
+		}
+		metric.Target = targetValue(target)
+		// the controller reports the current metrics in the order of the spec
+		if i < len(hpa.Status.CurrentMetrics) {
+			metric.Current = currentValue(hpa.Status.CurrentMetrics[i])
+		}
+		state.Metrics = append(state.Metrics, metric)
+	}
+
+	for _, condition := range hpa.Status.Conditions {
+		switch {
+		case condition.Type == autoscalingv2.ScalingLimited && condition.Status == corev1.ConditionTrue:
+			state.ScalingLimited = true
+			if state.Reason == "" {
+				state.Reason, state.Message = condition.Reason, condition.Message
+			}
+		case (condition.Type == autoscalingv2.AbleToScale || condition.Type == autoscalingv2.ScalingActive) && condition.Status == corev1.ConditionFalse:
+			// not being able to scale is more important than being limited
+			state.Reason, state.Message = condition.Reason, condition.Message
+		}
+	}
+	return state
+}
+
+// addAutoscalers attaches the autoscalers to the deployments and statefulsets they target, a
+// deployment missing replicas right after a scale up is scaling rather than degraded. The current
+// values of the metrics change with every sync of the autoscaler so they are left out of the status.
+func addAutoscalers(instances []model.InstanceState, hpas []*autoscalingv2.HorizontalPodAutoscaler, now time.Time) {
+	targets := map[string]*autoscalingv2.HorizontalPodAutoscaler{}
+	for _, hpa := range hpas {
+		targets[hpa.Spec.ScaleTargetRef.Kind+"/"+hpa.Spec.ScaleTargetRef.Name] = hpa
+	}
+	for i := range instances {
+		instance := &instances[i]
+		kind := ""
+		switch instance.Type {
+		case model.TypeBlock:
+			kind = "Deployment"
+		case model.TypeStatefulSet:
+			kind = "StatefulSet"
+		default:
+			continue
+		}
+		hpa := targets[kind+"/"+instance.Name]
+		if hpa == nil {
+			continue
+		}
+		instance.Autoscaler = AutoscalerState(hpa)
+		for j := range instance.Autoscaler.Metrics {
+			instance.Autoscaler.Metrics[j].Current = ""
+		}
+		if instance.State == model.StateDegraded && instance.Reason == "MinimumReplicasUnavailable" &&
+			hpa.Status.LastScaleTime != nil && now.Sub(hpa.Status.LastScaleTime.Time) < scalingGracePeriod {
+			instance.State, instance.Reason = model.StateProgressing, "Scaling"
+			instance.Message = fmt.Sprintf("the autoscaler scaled to %d replicas, %d are ready", instance.DesiredReplicas, instance.ReadyReplicas)
+		}
+	}
+}
+
+// FindAutoscaler returns the autoscaler targeting the workload of the kind and name, if any
+func FindAutoscaler(hpas []*autoscalingv2.HorizontalPodAutoscaler, kind string, name string) *autoscalingv2.HorizontalPodAutoscaler {
+	for _, hpa := range hpas {
+		if hpa.Spec.ScaleTargetRef.Kind == kind && hpa.Spec.ScaleTargetRef.Name == name {
+			return hpa
+		}
+	}
+	return nil
+}
+
+func targetValue(target autoscalingv2.MetricTarget) string {
+	switch {
+	case target.AverageUtilization != nil:
+		return fmt.Sprintf("%d%%", *target.AverageUtilization)
+	case target.AverageValue != nil:
+		return target.AverageValue.String()
+	case target.Value != nil:
+		return target.Value.String()
+	}
+	return ""
+}
+
+func currentValue(status autoscalingv2.MetricStatus) string {
+	var current autoscalingv2.MetricValueStatus
+	switch {
+	case status.Resource != nil:
+		current = status.Resource.Current
+	case status.ContainerResource != nil:
+		current = status.ContainerResource.Current
+	case status.Pods != nil:
+		current = status.Pods.Current
+	case status.Object != nil:
+		current = status.Object.Current
+	case status.External != nil:
+		current = status.External.Current
+	}
+	switch {
+	case current.AverageUtilization != nil:
+		return fmt.Sprintf("%d%%", *current.AverageUtilization)
+	case current.AverageValue != nil:
+		return current.AverageValue.String()
+	case current.Value != nil:
+		return current.Value.String()
+	}
+	return ""
+}
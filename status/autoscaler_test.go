@@ -0,0 +1,104 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testAutoscaler(target string, lastScale time.Time, conditions ...autoscalingv2.HorizontalPodAutoscalerCondition) *autoscalingv2.HorizontalPodAutoscaler {
+	minReplicas := int32(2)
+	utilization := int32(80)
+	current := int32(95)
+	requests := resource.MustParse("100")
+	lastScaleTime := metav1.NewTime(lastScale)
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: target + "-hpa", Namespace: "services"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: target},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    5,
+			Metrics: []autoscalingv2.MetricSpec{
+				{Type: autoscalingv2.ResourceMetricSourceType, Resource: &autoscalingv2.ResourceMetricSource{Name: corev1.ResourceCPU, Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &utilization}}},
+				{Type: autoscalingv2.PodsMetricSourceType, Pods: &autoscalingv2.PodsMetricSource{Metric: autoscalingv2.MetricIdentifier{Name: "requests_per_second"}, Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: &requests}}},
+			},
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{
+			LastScaleTime:   &lastScaleTime,
+			CurrentReplicas: 3,
+			DesiredReplicas: 5,
+			CurrentMetrics: []autoscalingv2.MetricStatus{
+				{Type: autoscalingv2.ResourceMetricSourceType, Resource: &autoscalingv2.ResourceMetricStatus{Name: corev1.ResourceCPU, Current: autoscalingv2.MetricValueStatus{AverageUtilization: &current}}},
+				{},
+			},
+			Conditions: conditions,
+		},
+	}
+}
+
+func TestAutoscalerState(t *testing.T) {
+	now := time.Now()
+	hpa := testAutoscaler("todo", now,
+		autoscalingv2.HorizontalPodAutoscalerCondition{Type: autoscalingv2.AbleToScale, Status: corev1.ConditionTrue, Reason: "SucceededRescale"},
+		autoscalingv2.HorizontalPodAutoscalerCondition{Type: autoscalingv2.ScalingLimited, Status: corev1.ConditionTrue, Reason: "TooManyReplicas", Message: "the desired replica count is more than the maximum replica count"},
+	)
+
+	state := AutoscalerState(hpa)
+	assert.Equal(t, int32(2), state.MinReplicas)
+	assert.Equal(t, int32(5), state.MaxReplicas)
+	assert.Equal(t, int32(3), state.CurrentReplicas)
+	assert.Equal(t, int32(5), state.DesiredReplicas)
+	assert.Equal(t, now.UnixMilli()/1000, state.LastScaleTime/1000)
+	assert.True(t, state.ScalingLimited)
+	assert.Equal(t, "TooManyReplicas", state.Reason)
+	assert.Equal(t, []model.AutoscalerMetric{
+		{Type: "Resource", Name: "cpu", Target: "80%", Current: "95%"},
+		{Type: "Pods", Name: "requests_per_second", Target: "100"},
+	}, state.Metrics)
+
+	hpa = testAutoscaler("todo", now,
+		autoscalingv2.HorizontalPodAutoscalerCondition{Type: autoscalingv2.ScalingActive, Status: corev1.ConditionFalse, Reason: "FailedGetResourceMetric", Message: "unable to get metrics"},
+	)
+	state = AutoscalerState(hpa)
+	assert.False(t, state.ScalingLimited)
+	assert.Equal(t, "FailedGetResourceMetric", state.Reason)
+}
+
+func TestAddAutoscalers(t *testing.T) {
+	now := time.Now()
+	degraded := func(name string) model.InstanceState {
+		return model.InstanceState{Type: model.TypeBlock, Name: name, State: model.StateDegraded, Reason: "MinimumReplicasUnavailable", ReadyReplicas: 3, DesiredReplicas: 5}
+	}
+	instances := []model.InstanceState{degraded("todo"), degraded("users"), degraded("orders")}
+	hpas := []*autoscalingv2.HorizontalPodAutoscaler{
+		testAutoscaler("todo", now.Add(-time.Minute)),
+		testAutoscaler("users", now.Add(-time.Hour)),
+	}
+
+	addAutoscalers(instances, hpas, now)
+	assert.NotNil(t, instances[0].Autoscaler)
+	assert.Equal(t, "80%", instances[0].Autoscaler.Metrics[0].Target)
+	assert.Empty(t, instances[0].Autoscaler.Metrics[0].Current)
+	assert.Equal(t, model.StateProgressing, instances[0].State)
+	assert.Equal(t, "Scaling", instances[0].Reason)
+
+	// a scale up long ago that still misses replicas is a problem
+	assert.NotNil(t, instances[1].Autoscaler)
+	assert.Equal(t, model.StateDegraded, instances[1].State)
+
+	assert.Nil(t, instances[2].Autoscaler)
+	assert.Equal(t, model.StateDegraded, instances[2].State)
+}
+
+func TestFindAutoscaler(t *testing.T) {
+	hpas := []*autoscalingv2.HorizontalPodAutoscaler{testAutoscaler("todo", time.Now())}
+	assert.Equal(t, hpas[0], FindAutoscaler(hpas, "Deployment", "todo"))
+	assert.Nil(t, FindAutoscaler(hpas, "StatefulSet", "todo"))
+	assert.Nil(t, FindAutoscaler(hpas, "Deployment", "users"))
+}
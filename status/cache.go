@@ -0,0 +1,847 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kapetacom/insight-api/kubernetes"
+	"github.com/kapetacom/insight-api/model"
+	"github.com/kapetacom/insight-api/operators"
+	"github.com/kapetacom/insight-api/operators/gcp"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	istioversioned "istio.io/client-go/pkg/clientset/versioned"
+	istioinformers "istio.io/client-go/pkg/informers/externalversions"
+	istiolisters "istio.io/client-go/pkg/listers/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	k8s "k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	autoscalinglisters "k8s.io/client-go/listers/autoscaling/v2"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const resyncPeriod = time.Minute
+
+// the status waits this long for the informers of the optional resources, an informer that hasn't
+// synced by then, e.g. because we aren't allowed to list its resources, is left out of the status
+var optionalSyncTimeout = 30 * time.Second
+
+// the window of the golden signals shown in the status
+const signalsWindow = 5 * time.Minute
+
+// ErrNotSynced is returned while the informers are still loading the initial state
+var ErrNotSynced = errors.New("the status cache has not synced yet")
+
+// ErrPrometheusNotConfigured is returned for the golden signals when PROMETHEUS_URL is not set
+var ErrPrometheusNotConfigured = errors.New("prometheus is not configured")
+
+// ErrHealthNotChecked is returned when the health endpoint of a block hasn't been probed
+var ErrHealthNotChecked = errors.New("the health of the instance has not been checked")
+
+// ErrAutoscalerNotFound is returned when no HorizontalPodAutoscaler targets the workload of a block
+var ErrAutoscalerNotFound = errors.New("the instance has no autoscaler")
+
+// ErrVersionNotFound is returned when the requested environment version is not stored in the cluster
+var ErrVersionNotFound = errors.New("environment version not found")
+
+var (
+	blockSelector       = mustParseSelector("kapeta.com/block-id")
+	environmentSelector = mustParseSelector("kapeta.com/environment-name")
+)
+
+// Cache keeps the resources the status is built from in memory using shared informers
+// for the watched namespaces, so a status request doesn't hit the API server
+type Cache struct {
+	mode      string
+	clientset k8s.Interface
+	factories []informers.SharedInformerFactory
+	istio     []istioinformers.SharedInformerFactory
+	dynamic   []dynamicinformer.DynamicSharedInformerFactory
+	cloudSQL  *gcp.CloudSQLView
+	traefik   *TraefikView
+	metrics   *MetricsView
+	signals   *SignalsView
+	synced    []cache.InformerSynced
+	optional  map[string]cache.InformerSynced
+	deadline  time.Time
+
+	deployments     appslisters.DeploymentLister
+	replicaSets     appslisters.ReplicaSetLister
+	statefulSets    appslisters.StatefulSetLister
+	daemonSets      appslisters.DaemonSetLister
+	jobs            batchlisters.JobLister
+	cronJobs        batchlisters.CronJobLister
+	autoscalers     autoscalinglisters.HorizontalPodAutoscalerLister
+	pods            corelisters.PodLister
+	services        corelisters.ServiceLister
+	endpointSlices  discoverylisters.EndpointSliceLister
+	secrets         corelisters.SecretLister
+	infrastructure  appslisters.DeploymentLister
+	infraPods       corelisters.PodLister
+	claims          corelisters.PersistentVolumeClaimLister
+	virtualServices istiolisters.VirtualServiceLister
+	istioGateways   istiolisters.GatewayLister
+	certificates    corelisters.SecretLister
+	ingresses       networkinglisters.IngressLister
+	httpRoutes      cache.GenericLister
+	gateways        cache.GenericLister
+	health          *healthProber
+	volumes         *volumeStats
+
+	changed chan struct{}
+}
+
+// NewCache creates the informers for the services, kapeta and infrastructure namespaces,
+// the VirtualServices are only watched if the Istio CRDs are installed, otherwise the
+// gateways are read from the Traefik API
+func NewCache(mode string) (*Cache, error) {
+	config := kubernetes.Config()
+	clientset, err := k8s.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error getting kubernetes client: %v", err)
+	}
+	var istioClient istioversioned.Interface
+	if hasGroupVersion(clientset, "networking.istio.io/v1beta1") {
+		istioClient, err = istioversioned.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("error getting istio client: %v", err)
+		}
+	} else {
+		log.Println("Istio CRDs are not installed, gateways are read from the Traefik API")
+	}
+	var dynamicClient, metricsClient dynamic.Interface
+	hasGatewayAPI := hasGroupVersion(clientset, GatewayAPIGroupVersion)
+	hasMetrics := hasGroupVersion(clientset, MetricsGroupVersion)
+	if hasGatewayAPI || hasMetrics {
+		client, err := kubernetes.DynamicKubernetesClient()
+		if err != nil {
+			return nil, fmt.Errorf("error getting dynamic client: %v", err)
+		}
+		if hasGatewayAPI {
+			dynamicClient = client
+		}
+		if hasMetrics {
+			metricsClient = client
+		}
+	}
+	if !hasMetrics {
+		log.Println("metrics-server is not installed, resource usage is not reported")
+	}
+	return newCache(mode, clientset, istioClient, dynamicClient, metricsClient), nil
+}
+
+func newCache(mode string, clientset k8s.Interface, istioClient istioversioned.Interface, dynamicClient dynamic.Interface, metricsClient dynamic.Interface) *Cache {
+	c := &Cache{mode: mode, clientset: clientset, optional: map[string]cache.InformerSynced{}, changed: make(chan struct{}, 1)}
+
+	services := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithNamespace("services"))
+	// only the environment secrets are cached, the kapeta namespace holds credentials as well
+	kapeta := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithNamespace("kapeta"),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = environmentSelector.String()
+		}))
+	infrastructure := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithNamespace("infrastructure"))
+	c.factories = []informers.SharedInformerFactory{services, kapeta, infrastructure}
+
+	c.deployments = watch(c, services.Apps().V1().Deployments().Informer(), services.Apps().V1().Deployments().Lister())
+	c.replicaSets = watchOptional(c, "replicasets", services.Apps().V1().ReplicaSets().Informer(), services.Apps().V1().ReplicaSets().Lister())
+	c.statefulSets = watchOptional(c, "statefulsets", services.Apps().V1().StatefulSets().Informer(), services.Apps().V1().StatefulSets().Lister())
+	c.daemonSets = watchOptional(c, "daemonsets", services.Apps().V1().DaemonSets().Informer(), services.Apps().V1().DaemonSets().Lister())
+	c.jobs = watchOptional(c, "jobs", services.Batch().V1().Jobs().Informer(), services.Batch().V1().Jobs().Lister())
+	c.cronJobs = watchOptional(c, "cronjobs", services.Batch().V1().CronJobs().Informer(), services.Batch().V1().CronJobs().Lister())
+	c.autoscalers = watchOptional(c, "horizontalpodautoscalers", services.Autoscaling().V2().HorizontalPodAutoscalers().Informer(), services.Autoscaling().V2().HorizontalPodAutoscalers().Lister())
+	c.pods = watch(c, services.Core().V1().Pods().Informer(), services.Core().V1().Pods().Lister())
+	c.services = watchOptional(c, "services", services.Core().V1().Services().Informer(), services.Core().V1().Services().Lister())
+	c.endpointSlices = watchOptional(c, "endpointslices", services.Discovery().V1().EndpointSlices().Informer(), services.Discovery().V1().EndpointSlices().Lister())
+	c.ingresses = watchOptional(c, "ingresses", services.Networking().V1().Ingresses().Informer(), services.Networking().V1().Ingresses().Lister())
+	c.secrets = watch(c, kapeta.Core().V1().Secrets().Informer(), kapeta.Core().V1().Secrets().Lister())
+	c.infrastructure = watchOptional(c, "infrastructure deployments", infrastructure.Apps().V1().Deployments().Informer(), infrastructure.Apps().V1().Deployments().Lister())
+	c.infraPods = watchOptional(c, "infrastructure pods", infrastructure.Core().V1().Pods().Informer(), infrastructure.Core().V1().Pods().Lister())
+	c.claims = watchOptional(c, "persistentvolumeclaims", infrastructure.Core().V1().PersistentVolumeClaims().Informer(), infrastructure.Core().V1().PersistentVolumeClaims().Lister())
+
+	if istioClient != nil {
+		istio := istioinformers.NewSharedInformerFactoryWithOptions(istioClient, resyncPeriod, istioinformers.WithNamespace("services"))
+		virtualServices := istio.Networking().V1beta1().VirtualServices()
+		c.virtualServices = watchOptional(c, "virtualservices", virtualServices.Informer(), virtualServices.Lister())
+
+		// the gateways and their certificates aren't part of the status, so they don't signal changes
+		gateways := istioinformers.NewSharedInformerFactoryWithOptions(istioClient, resyncPeriod)
+		c.istio = []istioinformers.SharedInformerFactory{istio, gateways}
+		c.istioGateways = gateways.Networking().V1beta1().Gateways().Lister()
+		c.optional["istio gateways"] = gateways.Networking().V1beta1().Gateways().Informer().HasSynced
+		certificates := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithTransform(certificateOnly))
+		c.factories = append(c.factories, certificates)
+		c.certificates = certificates.Core().V1().Secrets().Lister()
+		c.optional["gateway certificates"] = certificates.Core().V1().Secrets().Informer().HasSynced
+	} else {
+		c.traefik = NewTraefikView(clientset, 30*time.Second, c.touch)
+	}
+
+	if dynamicClient != nil {
+		// the routes live next to the blocks while the gateways usually have a namespace of their own
+		routes := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resyncPeriod, "services", nil)
+		gateways := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resyncPeriod, metav1.NamespaceAll, nil)
+		c.dynamic = []dynamicinformer.DynamicSharedInformerFactory{routes, gateways}
+		c.httpRoutes = watchOptional(c, "httproutes", routes.ForResource(HTTPRouteResource).Informer(), routes.ForResource(HTTPRouteResource).Lister())
+		c.gateways = watchOptional(c, "gateway api gateways", gateways.ForResource(GatewayResource).Informer(), gateways.ForResource(GatewayResource).Lister())
+	}
+
+	if metricsClient != nil {
+		c.metrics = NewMetricsView(metricsClient, 30*time.Second)
+	}
+	if url := os.Getenv("PROMETHEUS_URL"); url != "" {
+		c.signals = NewSignalsView(NewPrometheusClient(url), signalsWindow, 30*time.Second)
+	}
+
+	c.health = newHealthProber(clientset, c.services, healthProbeTimeout, c.touch)
+	// the kubelet stats need the nodes/proxy permission, which allows a lot more than reading stats
+	if os.Getenv("VOLUME_STATS_ENABLED") == "true" {
+		c.volumes = newVolumeStats(clientset, c.infraPods, c.touch)
+	}
+
+	if mode != "kubernetes-only" {
+		c.cloudSQL = gcp.NewCloudSQLView(time.Minute)
+	}
+	return c
+}
+
+// watch registers an informer the status can't be built without, the status is only served
+// once it has synced
+func watch[T any](c *Cache, informer cache.SharedIndexInformer, lister T) T {
+	c.synced = append(c.synced, informer.HasSynced)
+	return watchChanges(c, informer, lister)
+}
+
+// watchOptional registers an informer the status is waited on for at most optionalSyncTimeout
+func watchOptional[T any](c *Cache, name string, informer cache.SharedIndexInformer, lister T) T {
+	c.optional[name] = informer.HasSynced
+	return watchChanges(c, informer, lister)
+}
+
+// watchChanges lets us know when something changed
+func watchChanges[T any](c *Cache, informer cache.SharedIndexInformer, lister T) T {
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.touch() },
+		UpdateFunc: func(oldObj, newObj interface{}) { c.touch() },
+		DeleteFunc: func(obj interface{}) { c.touch() },
+	})
+	return lister
+}
+
+func (c *Cache) touch() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Changed is signalled when any of the watched resources changed, a burst of
+// changes may only be signalled once
+func (c *Cache) Changed() <-chan struct{} {
+	return c.changed
+}
+
+// Start starts the informers, the Cloud SQL and Traefik refresh, the health probes and the volume stats if enabled, they stop when the context is cancelled
+func (c *Cache) Start(ctx context.Context) {
+	c.deadline = time.Now().Add(optionalSyncTimeout)
+	go c.logUnsynced(ctx)
+	for _, factory := range c.factories {
+		factory.Start(ctx.Done())
+	}
+	for _, factory := range c.istio {
+		factory.Start(ctx.Done())
+	}
+	for _, factory := range c.dynamic {
+		factory.Start(ctx.Done())
+	}
+	if c.cloudSQL != nil {
+		c.cloudSQL.Start(ctx)
+	}
+	if c.traefik != nil {
+		c.traefik.Start(ctx)
+	}
+	if c.metrics != nil {
+		c.metrics.Start(ctx)
+	}
+	if c.signals != nil {
+		c.signals.Start(ctx)
+	}
+	c.health.start(ctx, healthProbeInterval, c.HasSynced)
+	if c.volumes != nil {
+		c.volumes.start(ctx, volumeStatsInterval, c.HasSynced)
+	}
+}
+
+// HasSynced returns true once the deployments, pods and environment secrets have loaded the
+// initial state and the optional informers have too, or didn't within optionalSyncTimeout
+func (c *Cache) HasSynced() bool {
+	for _, synced := range c.synced {
+		if !synced() {
+			return false
+		}
+	}
+	if time.Now().After(c.deadline) {
+		return true
+	}
+	for _, synced := range c.optional {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cache) logUnsynced(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(optionalSyncTimeout):
+	}
+	for name, synced := range c.optional {
+		if !synced() {
+			log.Printf("the %v have not synced within %v, they are left out of the status until they do\n", name, optionalSyncTimeout)
+		}
+	}
+}
+
+// ClusterStatus builds the status of the environment from memory
+func (c *Cache) ClusterStatus() (*model.ClusterStatus, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	secrets, err := c.secrets.List(environmentSelector)
+	if err != nil {
+		return nil, err
+	}
+	clusterStatus, err := EnvironmentInfo(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []model.InstanceState{}
+	result = append(result, c.Gateways()...)
+	instances, err := c.Instances()
+	if err != nil {
+		return nil, err
+	}
+	clusterStatus.Instances = append(result, instances...)
+	if c.signals != nil {
+		workloads, services := c.signals.Signals()
+		addSignals(clusterStatus.Instances, workloads, services)
+	}
+
+	deployment, err := kubernetes.DecodeDeployment(kubernetes.LatestSecret(secrets))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding deployment: %v", err)
+	}
+	infrastructure, err := c.infrastructure.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	clusterStatus.Operators = operators.GetDatabaseState(c.mode, deployment, infrastructure, c.cloudSQL)
+	claims, err := c.claims.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var usage map[string]VolumeUsage
+	if c.volumes != nil {
+		usage = c.volumes.lastUsage()
+	}
+	addVolumes(clusterStatus.Operators, infrastructure, claims, usage, time.Now())
+	clusterStatus.UpdatedAt = c.updatedAt(deployment, time.Now())
+	return clusterStatus, nil
+}
+
+// updatedAt returns the time of the oldest data the status is built from. The informers are kept up
+// to date by their watches so they are current, the views and probes are refreshed separately and
+// count once they have been refreshed.
+func (c *Cache) updatedAt(deployment *kapetamodel.Deployment, now time.Time) int64 {
+	updated := now
+	oldest := func(refreshed time.Time) {
+		if !refreshed.IsZero() && refreshed.Before(updated) {
+			updated = refreshed
+		}
+	}
+	if c.cloudSQL != nil {
+		for _, svc := range deployment.Spec.Services {
+			if svc.Kind == "kapeta/resource-type-postgresql" {
+				_, refreshed, _ := c.cloudSQL.Instances()
+				oldest(refreshed)
+				break
+			}
+		}
+	}
+	if c.traefik != nil {
+		oldest(c.traefik.Updated())
+	}
+	if c.metrics != nil {
+		_, refreshed := c.metrics.Usage()
+		oldest(refreshed)
+	}
+	if c.signals != nil {
+		oldest(c.signals.Updated())
+	}
+	for _, result := range c.health.lastResults() {
+		oldest(result.CheckedAt)
+	}
+	if c.volumes != nil {
+		oldest(c.volumes.lastUpdated())
+	}
+	return updated.UnixMilli()
+}
+
+// Drift compares the deployment descriptor of the environment with the workloads and databases in the cluster
+func (c *Cache) Drift() (*model.DriftReport, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	secrets, err := c.secrets.List(environmentSelector)
+	if err != nil {
+		return nil, err
+	}
+	clusterStatus, err := EnvironmentInfo(secrets)
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := kubernetes.DecodeDeployment(kubernetes.LatestSecret(secrets))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding deployment: %v", err)
+	}
+
+	deployments, err := c.deployments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	statefulSets, err := c.statefulSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	daemonSets, err := c.daemonSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	infrastructure, err := c.infrastructure.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	drift := DetectDrift(deployment, Workloads(deployments, statefulSets, daemonSets), func(svc kapetamodel.DeploymentServiceInstance) (bool, bool) {
+		return operators.HasBackingResource(c.mode, deployment, svc, infrastructure, c.cloudSQL)
+	})
+	return &model.DriftReport{
+		EnvironmentName:    clusterStatus.EnvironmentName,
+		EnvironmentVersion: clusterStatus.EnvironmentVersion,
+		InSync:             len(drift) == 0,
+		Drift:              drift,
+	}, nil
+}
+
+// Versions lists the environment versions stored in the cluster, the newest first
+func (c *Cache) Versions() ([]model.EnvironmentVersion, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	secrets, err := c.secrets.List(environmentSelector)
+	if err != nil {
+		return nil, err
+	}
+	return EnvironmentVersions(secrets), nil
+}
+
+// VersionDiff compares the deployment descriptors of two environment versions, an empty to is the
+// newest version and an empty from is the version before to
+func (c *Cache) VersionDiff(from string, to string) (*model.VersionDiff, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	secrets, err := c.secrets.List(environmentSelector)
+	if err != nil {
+		return nil, err
+	}
+	sorted := kubernetes.SortByEnvironmentVersion(secrets)
+	toIndex := 0
+	if to != "" {
+		if toIndex = versionIndex(sorted, to); toIndex < 0 {
+			return nil, fmt.Errorf("%w: %v", ErrVersionNotFound, to)
+		}
+	}
+	fromIndex := toIndex + 1
+	if from != "" {
+		if fromIndex = versionIndex(sorted, from); fromIndex < 0 {
+			return nil, fmt.Errorf("%w: %v", ErrVersionNotFound, from)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil, fmt.Errorf("%w: no environment versions are stored", ErrVersionNotFound)
+	}
+	if fromIndex >= len(sorted) {
+		return nil, fmt.Errorf("%w: there is no version before %v", ErrVersionNotFound, sorted[toIndex].Labels["kapeta.com/environment-version"])
+	}
+
+	fromDeployment, err := kubernetes.DecodeDeployment(sorted[fromIndex])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding deployment: %v", err)
+	}
+	toDeployment, err := kubernetes.DecodeDeployment(sorted[toIndex])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding deployment: %v", err)
+	}
+	diff := DiffDeployments(fromDeployment, toDeployment)
+	diff.EnvironmentName = sorted[toIndex].Labels["kapeta.com/environment-name"]
+	diff.From = sorted[fromIndex].Labels["kapeta.com/environment-version"]
+	diff.To = sorted[toIndex].Labels["kapeta.com/environment-version"]
+	return &diff, nil
+}
+
+func versionIndex(secrets []*corev1.Secret, version string) int {
+	for i, secret := range secrets {
+		if secret.Labels["kapeta.com/environment-version"] == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rollout returns the progress of the blocks towards the newest environment version
+func (c *Cache) Rollout() (*model.RolloutProgress, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	secrets, err := c.secrets.List(environmentSelector)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("%w: no environment versions are stored", ErrVersionNotFound)
+	}
+	deployments, err := c.deployments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	replicaSets, err := c.replicaSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	// only the blocks changed by the newest version have to be updated, the first version changes them all
+	sorted := kubernetes.SortByEnvironmentVersion(secrets)
+	var changed map[string]bool
+	if len(sorted) > 1 {
+		from, err := kubernetes.DecodeDeployment(sorted[1])
+		if err != nil {
+			return nil, fmt.Errorf("error decoding deployment: %v", err)
+		}
+		to, err := kubernetes.DecodeDeployment(sorted[0])
+		if err != nil {
+			return nil, fmt.Errorf("error decoding deployment: %v", err)
+		}
+		changed = changedBlocks(DiffDeployments(from, to))
+	}
+	progress := Rollout(sorted[0], changed, deployments, replicaSets, time.Now())
+	return &progress, nil
+}
+
+// Topology returns the graph of the services of the deployment with the live state of each
+func (c *Cache) Topology() (*model.Topology, error) {
+	clusterStatus, err := c.ClusterStatus()
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := c.secrets.List(environmentSelector)
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := kubernetes.DecodeDeployment(kubernetes.LatestSecret(secrets))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding deployment: %v", err)
+	}
+	topology := BuildTopology(deployment, clusterStatus)
+	return &topology, nil
+}
+
+// Signals queries the golden signals over the window from Prometheus
+func (c *Cache) Signals(ctx context.Context, window time.Duration, windowName string) (*model.SignalsReport, error) {
+	if c.signals == nil {
+		return nil, ErrPrometheusNotConfigured
+	}
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	instances, err := c.Instances()
+	if err != nil {
+		return nil, err
+	}
+	instances = append(c.Gateways(), instances...)
+	workloads, services, err := c.signals.prometheus.Signals(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+	report := BuildSignalsReport(windowName, instances, workloads, services)
+	return &report, nil
+}
+
+// GatewayInfos returns the Istio gateways with the certificates of their servers
+func (c *Cache) GatewayInfos() ([]model.GatewayInfo, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	if c.istioGateways == nil {
+		return []model.GatewayInfo{}, nil
+	}
+	gateways, err := c.istioGateways.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(namespace string, name string) (*corev1.Secret, error) {
+		return c.certificates.Secrets(namespace).Get(name)
+	}
+	return GatewayInfos(gateways, lookup, time.Now()), nil
+}
+
+// Gateways returns the state of the ingress routes, from the VirtualServices or the Traefik API
+// together with the Ingress and Gateway API resources
+func (c *Cache) Gateways() []model.InstanceState {
+	result := []model.InstanceState{}
+	services, err := c.services.List(labels.Everything())
+	if err != nil {
+		return result
+	}
+	endpointSlices, err := c.endpointSlices.List(labels.Everything())
+	if err != nil {
+		return result
+	}
+
+	if c.traefik != nil {
+		gateways := c.traefik.Gateways()
+		addTraefikBlockIDs(gateways, services)
+		result = append(result, gateways...)
+	} else if virtualServices, err := c.virtualServices.List(labels.Everything()); err == nil {
+		result = append(result, GatewayStates(virtualServices, services, endpointSlices)...)
+	}
+	if ingresses, err := c.ingresses.List(labels.Everything()); err == nil {
+		result = append(result, IngressStates(ingresses, services, endpointSlices)...)
+	}
+	if c.httpRoutes != nil {
+		routes, err := c.httpRoutes.List(labels.Everything())
+		if err != nil {
+			return result
+		}
+		gateways, err := c.gateways.List(labels.Everything())
+		if err != nil {
+			return result
+		}
+		result = append(result, GatewayAPIStates(routes, gateways, services, endpointSlices)...)
+	}
+	sortInstances(result)
+	return result
+}
+
+// Instances returns the state of the blocks in the services namespace, deployed
+// as Deployments or StatefulSets, together with DaemonSets, Jobs and CronJobs
+func (c *Cache) Instances() ([]model.InstanceState, error) {
+	result := []model.InstanceState{}
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := c.deployments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		result = append(result, DeploymentState(deployment, PodsForSelector(deployment.Spec.Selector, pods)))
+	}
+
+	statefulSets, err := c.statefulSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, sts := range statefulSets {
+		result = append(result, StatefulSetState(sts, PodsForSelector(sts.Spec.Selector, pods)))
+	}
+
+	daemonSets, err := c.daemonSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range daemonSets {
+		result = append(result, DaemonSetState(ds, PodsForSelector(ds.Spec.Selector, pods)))
+	}
+
+	// jobs and cronjobs are only included if they belong to a block, e.g. migrations
+	jobs, err := c.jobs.List(blockSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		// jobs created by a cronjob are reported through the cronjob
+		if HasOwnerKind(job, "CronJob") {
+			continue
+		}
+		result = append(result, JobState(job, PodsForSelector(job.Spec.Selector, pods)))
+	}
+
+	cronJobs, err := c.cronJobs.List(blockSelector)
+	if err != nil {
+		return nil, err
+	}
+	// the jobs of a cronjob carry the labels of its job template, they are matched by owner instead
+	allJobs, err := c.jobs.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, cronJob := range cronJobs {
+		result = append(result, CronJobState(cronJob, allJobs))
+	}
+
+	// jobs share the block id with the block they belong to, only the block serves the health endpoint
+	health := c.health.lastResults()
+	for i := range result {
+		if result[i].Type == model.TypeJob || result[i].Type == model.TypeCronJob {
+			continue
+		}
+		if probe, ok := health[result[i].BlockID]; ok && result[i].BlockID != "" {
+			addHealth(&result[i], probe)
+		}
+	}
+	autoscalers, err := c.autoscalers.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	addAutoscalers(result, autoscalers, time.Now())
+	c.addMemoryWarnings(result, pods)
+	sortInstances(result)
+	return result, nil
+}
+
+// sortInstances orders the instances by type and name, the listers return them in no particular order
+func sortInstances(instances []model.InstanceState) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		if instances[i].Type != instances[j].Type {
+			return instances[i].Type < instances[j].Type
+		}
+		return instances[i].Name < instances[j].Name
+	})
+}
+
+// addMemoryWarnings flags the instances with a container close to its memory limit
+func (c *Cache) addMemoryWarnings(instances []model.InstanceState, pods []*corev1.Pod) {
+	if c.metrics == nil {
+		return
+	}
+	usage, updated := c.metrics.Usage()
+	if usage == nil {
+		return
+	}
+	byBlock := map[string][]*corev1.Pod{}
+	for _, pod := range pods {
+		if blockID := pod.Labels["kapeta.com/block-id"]; blockID != "" {
+			byBlock[blockID] = append(byBlock[blockID], pod)
+		}
+	}
+	for i := range instances {
+		if instances[i].Type == model.TypeGateway || instances[i].BlockID == "" {
+			continue
+		}
+		if InstanceResources(instances[i].BlockID, byBlock[instances[i].BlockID], usage, updated).NearMemoryLimit {
+			if instances[i].Metadata == nil {
+				instances[i].Metadata = map[string]string{}
+			}
+			instances[i].Metadata["kapeta.com/near_memory_limit"] = "true"
+		}
+	}
+}
+
+// InstanceResources returns the cpu and memory usage of the pods of the instance
+func (c *Cache) InstanceResources(blockID string) (*model.InstanceResources, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	selector, err := labels.Parse("kapeta.com/block-id=" + blockID)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.pods.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	var usage map[string]corev1.ResourceList
+	var updated time.Time
+	if c.metrics != nil {
+		usage, updated = c.metrics.Usage()
+	}
+	resources := InstanceResources(blockID, pods, usage, updated)
+	return &resources, nil
+}
+
+// InstanceHealth returns the last health probe of a block with its latency
+func (c *Cache) InstanceHealth(blockID string) (*model.HealthCheck, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	result, ok := c.health.lastResults()[blockID]
+	if !ok {
+		return nil, ErrHealthNotChecked
+	}
+	check := HealthCheck(blockID, result)
+	return &check, nil
+}
+
+// InstanceAutoscaler returns the state of the autoscaler of a block with the current values of its metrics
+func (c *Cache) InstanceAutoscaler(blockID string) (*model.AutoscalerState, error) {
+	if !c.HasSynced() {
+		return nil, ErrNotSynced
+	}
+	selector, err := labels.Parse("kapeta.com/block-id=" + blockID)
+	if err != nil {
+		return nil, err
+	}
+	hpas, err := c.autoscalers.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	deployments, err := c.deployments.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		if hpa := FindAutoscaler(hpas, "Deployment", deployment.Name); hpa != nil {
+			return AutoscalerState(hpa), nil
+		}
+	}
+	statefulSets, err := c.statefulSets.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets {
+		if hpa := FindAutoscaler(hpas, "StatefulSet", statefulSet.Name); hpa != nil {
+			return AutoscalerState(hpa), nil
+		}
+	}
+	return nil, ErrAutoscalerNotFound
+}
+
+func hasGroupVersion(clientset k8s.Interface, groupVersion string) bool {
+	_, err := clientset.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	return err == nil
+}
+
+func mustParseSelector(selector string) labels.Selector {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		panic(err.Error())
+	}
+	return s
+}
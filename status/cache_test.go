@@ -0,0 +1,227 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	"github.com/stretchr/testify/assert"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworking "istio.io/client-go/pkg/apis/networking/v1beta1"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testEnvironmentSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kapeta",
+			Namespace: "kapeta",
+			Labels: map[string]string{
+				"kapeta.com/environment-name":    "production",
+				"kapeta.com/environment-version": "3",
+				"kapeta.com/plan-name":           "kapeta/todo",
+			},
+		},
+		Data: map[string][]byte{"config": []byte(`{
+			"kind": "core/deployment",
+			"metadata": {"name": "kapeta/production"},
+			"spec": {"services": [{"id": "db-1", "kind": "kapeta/resource-type-mongodb"}]}
+		}`)},
+	}
+}
+
+func startTestCache(t *testing.T, objects []runtime.Object, istioObjects []runtime.Object, dynamicObjects ...runtime.Object) *Cache {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		HTTPRouteResource: "HTTPRouteList",
+		GatewayResource:   "GatewayList",
+	}, dynamicObjects...)
+	c := newCache("kubernetes-only", fake.NewSimpleClientset(objects...), istiofake.NewSimpleClientset(istioObjects...), dynamicClient, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c.Start(ctx)
+	assert.Eventually(t, c.HasSynced, 5*time.Second, 10*time.Millisecond)
+	return c
+}
+
+func TestCacheClusterStatus(t *testing.T) {
+	replicas := int32(1)
+	objects := []runtime.Object{
+		testEnvironmentSecret(),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "registry-credentials", Namespace: "kapeta"}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "todo", Namespace: "services", Labels: map[string]string{"kapeta.com/block-id": "block-1"}},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "mongodb", Namespace: "infrastructure", Labels: map[string]string{"kapeta.com/block-id": "db-1"}},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+	}
+	istioObjects := []runtime.Object{
+		&istionetworking.VirtualService{
+			ObjectMeta: metav1.ObjectMeta{Name: "todo-gateway", Namespace: "services", Labels: map[string]string{"kapeta.com/block-id": "gateway-1"}},
+			Spec: networkingv1beta1.VirtualService{Http: []*networkingv1beta1.HTTPRoute{{
+				Match: []*networkingv1beta1.HTTPMatchRequest{{Uri: &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Prefix{Prefix: "/api"}}}},
+			}}},
+		},
+	}
+	c := startTestCache(t, objects, istioObjects)
+
+	clusterStatus, err := c.ClusterStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, "production", clusterStatus.EnvironmentName)
+	assert.Equal(t, "3", clusterStatus.EnvironmentVersion)
+	assert.NotZero(t, clusterStatus.UpdatedAt)
+
+	assert.Len(t, clusterStatus.Instances, 2)
+	assert.Equal(t, model.TypeGateway, clusterStatus.Instances[0].Type)
+	assert.Equal(t, "/api", clusterStatus.Instances[0].Metadata["kapeta.com/api_path"])
+	assert.Equal(t, model.TypeBlock, clusterStatus.Instances[1].Type)
+	assert.Equal(t, model.StateReady, clusterStatus.Instances[1].State)
+
+	assert.Len(t, clusterStatus.Operators, 1)
+	assert.Equal(t, "mongodb", clusterStatus.Operators[0].Name)
+	assert.Equal(t, "Ready", clusterStatus.Operators[0].State)
+
+	// secrets that aren't environments aren't cached
+	_, err = c.secrets.Secrets("kapeta").Get("registry-credentials")
+	assert.Error(t, err)
+}
+
+func TestCacheOptionalInformers(t *testing.T) {
+	timeout := optionalSyncTimeout
+	optionalSyncTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { optionalSyncTimeout = timeout })
+
+	clientset := fake.NewSimpleClientset(testEnvironmentSecret())
+	clientset.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "autoscaling", Resource: "horizontalpodautoscalers"}, "", nil)
+	})
+	c := newCache("kubernetes-only", clientset, istiofake.NewSimpleClientset(), nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c.Start(ctx)
+
+	// the status waits for the autoscalers for a while but doesn't refuse to serve without them
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, c.HasSynced())
+	assert.Eventually(t, c.HasSynced, 5*time.Second, 10*time.Millisecond)
+	clusterStatus, err := c.ClusterStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, "production", clusterStatus.EnvironmentName)
+}
+
+func TestCacheCronJobRuns(t *testing.T) {
+	objects := []runtime.Object{
+		testEnvironmentSecret(),
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "cleanup", Namespace: "services", UID: "cron-uid", Labels: map[string]string{"kapeta.com/block-id": "block-1"}},
+			Spec:       batchv1.CronJobSpec{Schedule: "0 * * * *"},
+		},
+		// the job only has the labels of the job template
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "cleanup-1", Namespace: "services", OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", UID: "cron-uid"}}},
+			Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}},
+		},
+	}
+	c := startTestCache(t, objects, nil)
+
+	instances, err := c.Instances()
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+	assert.Equal(t, model.TypeCronJob, instances[0].Type)
+	assert.Equal(t, model.StateFailed, instances[0].State)
+	assert.Equal(t, "BackoffLimitExceeded", instances[0].Reason)
+}
+
+func TestCacheGatewayInfos(t *testing.T) {
+	now := time.Now()
+	objects := []runtime.Object{
+		testEnvironmentSecret(),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "todo-cert", Namespace: "istio-system"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: testCertificate(t, now.Add(60*24*time.Hour)), corev1.TLSPrivateKeyKey: []byte("private")},
+		},
+	}
+	// created through the client, the fake would track a Gateway object as another version
+	istioClient := istiofake.NewSimpleClientset()
+	_, err := istioClient.NetworkingV1beta1().Gateways("istio-system").Create(context.Background(), &istionetworking.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "todo-gateway", Namespace: "istio-system"},
+		Spec: networkingv1beta1.Gateway{Servers: []*networkingv1beta1.Server{{
+			Port:  &networkingv1beta1.Port{Number: 443, Protocol: "HTTPS", Name: "https"},
+			Hosts: []string{"todo.example.com"},
+			Tls:   &networkingv1beta1.ServerTLSSettings{Mode: networkingv1beta1.ServerTLSSettings_SIMPLE, CredentialName: "todo-cert"},
+		}}},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	c := newCache("kubernetes-only", fake.NewSimpleClientset(objects...), istioClient, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c.Start(ctx)
+	assert.Eventually(t, c.HasSynced, 5*time.Second, 10*time.Millisecond)
+
+	gateways, err := c.GatewayInfos()
+	assert.NoError(t, err)
+	assert.Len(t, gateways, 1)
+	assert.Equal(t, model.StateReady, gateways[0].State)
+	assert.NotNil(t, gateways[0].Servers[0].Certificate)
+
+	// only the certificate is cached
+	secret, err := c.certificates.Secrets("istio-system").Get("todo-cert")
+	assert.NoError(t, err)
+	assert.NotContains(t, secret.Data, corev1.TLSPrivateKeyKey)
+}
+
+func TestCacheGatewayAPI(t *testing.T) {
+	objects := []runtime.Object{testEnvironmentSecret(), blockService("todo", "block-1"), endpointSlice("todo", true)}
+	accepted := []interface{}{condition("Accepted", "True", "Accepted")}
+	c := startTestCache(t, objects, nil, testHTTPRoute("todo-route", "todo", accepted), testGateway("True"))
+
+	gateways := c.Gateways()
+	assert.Len(t, gateways, 1)
+	assert.Equal(t, "todo-route", gateways[0].Name)
+	assert.Equal(t, model.StateReady, gateways[0].State)
+	assert.Equal(t, "gateway-api", gateways[0].Metadata["kapeta.com/provider"])
+}
+
+func TestCacheUpdatedAt(t *testing.T) {
+	now := time.Now()
+	c := &Cache{
+		traefik: &TraefikView{updated: now.Add(-20 * time.Second)},
+		health:  &healthProber{results: map[string]HealthResult{"block-1": {CheckedAt: now.Add(-40 * time.Second)}}},
+		volumes: &volumeStats{},
+	}
+	deployment := &kapetamodel.Deployment{}
+	assert.Equal(t, now.Add(-40*time.Second).UnixMilli(), c.updatedAt(deployment, now))
+
+	// views that haven't been refreshed yet don't count
+	c.health.results = map[string]HealthResult{}
+	assert.Equal(t, now.Add(-20*time.Second).UnixMilli(), c.updatedAt(deployment, now))
+}
+
+func TestSortInstances(t *testing.T) {
+	instances := []model.InstanceState{
+		{Type: model.TypeJob, Name: "migrate"},
+		{Type: model.TypeBlock, Name: "users"},
+		{Type: model.TypeBlock, Name: "todo"},
+	}
+	sortInstances(instances)
+	assert.Equal(t, "todo", instances[0].Name)
+	assert.Equal(t, "users", instances[1].Name)
+	assert.Equal(t, "migrate", instances[2].Name)
+}
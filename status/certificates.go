@@ -0,0 +1,139 @@
+package status
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	istionetworking "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// certificates expiring within this many days degrade the gateway
+const certificateWarningDays = 14
+
+// SecretLookup returns the secret by namespace and name
+type SecretLookup func(namespace string, name string) (*corev1.Secret, error)
+
+// GatewayInfos describes the servers of the gateways and decodes the certificate
+// referenced by the credentialName of each server using TLS
+func GatewayInfos(gateways []*istionetworking.Gateway, lookup SecretLookup, now time.Time) []model.GatewayInfo {
+	result := []model.GatewayInfo{}
+	for _, gw := range gateways {
+		info := model.GatewayInfo{
+			Name:      gw.Name,
+			Namespace: gw.Namespace,
+			Selector:  gw.Spec.GetSelector(),
+			State:     model.StateReady,
+			Servers:   []model.GatewayServer{},
+		}
+		problems := []string{}
+		for _, server := range gw.Spec.GetServers() {
+			s := model.GatewayServer{
+				Name:     server.GetName(),
+				Port:     server.GetPort().GetNumber(),
+				Protocol: server.GetPort().GetProtocol(),
+				Hosts:    server.GetHosts(),
+			}
+			if tls := server.GetTls(); tls != nil {
+				s.TLSMode = tls.GetMode().String()
+				s.CredentialName = tls.GetCredentialName()
+			}
+			if s.CredentialName != "" {
+				s.Certificate, s.Error = gatewayCertificate(gw.Namespace, s.CredentialName, lookup, now)
+				switch {
+				case s.Error != "":
+					info.State, info.Reason = model.StateFailed, "CertificateError"
+					problems = append(problems, s.Error)
+				case s.Certificate.Expired:
+					info.State, info.Reason = model.StateFailed, "CertificateExpired"
+					problems = append(problems, fmt.Sprintf("certificate %v expired %v", s.CredentialName, time.UnixMilli(s.Certificate.NotAfter).Format(time.RFC3339)))
+				case s.Certificate.DaysUntilExpiry < certificateWarningDays:
+					if info.State == model.StateReady {
+						info.State, info.Reason = model.StateDegraded, "CertificateExpiring"
+					}
+					problems = append(problems, fmt.Sprintf("certificate %v expires in %d days", s.CredentialName, s.Certificate.DaysUntilExpiry))
+				}
+			}
+			info.Servers = append(info.Servers, s)
+		}
+		info.Message = strings.Join(problems, ", ")
+		result = append(result, info)
+	}
+	return result
+}
+
+// gatewayCertificate looks up the credential next to the gateway first and in istio-system second,
+// the secret has to live in the namespace of the gateway workload which usually is istio-system
+func gatewayCertificate(namespace string, credentialName string, lookup SecretLookup, now time.Time) (*model.CertificateInfo, string) {
+	var secret *corev1.Secret
+	var err error
+	for _, ns := range []string{namespace, "istio-system"} {
+		secret, err = lookup(ns, credentialName)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("error getting secret %v: %v", credentialName, err)
+	}
+	certificate, err := CertificateFromSecret(secret, now)
+	if err != nil {
+		return nil, fmt.Sprintf("error reading certificate %v: %v", credentialName, err)
+	}
+	return certificate, ""
+}
+
+// certificateOnly strips a secret down to its certificate before it is cached,
+// so the cache never holds private keys or any other credentials
+func certificateOnly(obj interface{}) (interface{}, error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return obj, nil
+	}
+	data := map[string][]byte{}
+	for _, key := range []string{corev1.TLSCertKey, "cert"} {
+		if value, ok := secret.Data[key]; ok {
+			data[key] = value
+		}
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Namespace: secret.Namespace, UID: secret.UID, ResourceVersion: secret.ResourceVersion},
+		Type:       secret.Type,
+		Data:       data,
+	}, nil
+}
+
+// CertificateFromSecret decodes the leaf certificate of a kubernetes.io/tls secret or of
+// the generic secret format used by Istio with a cert key
+func CertificateFromSecret(secret *corev1.Secret, now time.Time) (*model.CertificateInfo, error) {
+	data, ok := secret.Data[corev1.TLSCertKey]
+	if !ok {
+		data, ok = secret.Data["cert"]
+	}
+	if !ok {
+		return nil, errors.New("the secret has no certificate")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("the certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &model.CertificateInfo{
+		Subject:         cert.Subject.String(),
+		Issuer:          cert.Issuer.String(),
+		DNSNames:        cert.DNSNames,
+		NotBefore:       cert.NotBefore.UnixMilli(),
+		NotAfter:        cert.NotAfter.UnixMilli(),
+		DaysUntilExpiry: int(cert.NotAfter.Sub(now).Hours() / 24),
+		Expired:         now.After(cert.NotAfter),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package status
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworking "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testCertificate(t *testing.T, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "todo.example.com"},
+		DNSNames:     []string{"todo.example.com", "www.todo.example.com"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func tlsGateway(credentialName string) *istionetworking.Gateway {
+	return &istionetworking.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "services"},
+		Spec: networkingv1beta1.Gateway{
+			Selector: map[string]string{"istio": "ingressgateway"},
+			Servers: []*networkingv1beta1.Server{
+				{Port: &networkingv1beta1.Port{Number: 80, Protocol: "HTTP", Name: "http"}, Hosts: []string{"*"}},
+				{
+					Port:  &networkingv1beta1.Port{Number: 443, Protocol: "HTTPS", Name: "https"},
+					Hosts: []string{"todo.example.com"},
+					Tls:   &networkingv1beta1.ServerTLSSettings{Mode: networkingv1beta1.ServerTLSSettings_SIMPLE, CredentialName: credentialName},
+				},
+			},
+		},
+	}
+}
+
+func TestGatewayInfos(t *testing.T) {
+	now := time.Now()
+	secrets := map[string]*corev1.Secret{
+		"istio-system/valid":    {Data: map[string][]byte{corev1.TLSCertKey: testCertificate(t, now.Add(60*24*time.Hour+time.Hour))}},
+		"services/expiring":     {Data: map[string][]byte{"cert": testCertificate(t, now.Add(3*24*time.Hour))}},
+		"istio-system/expired":  {Data: map[string][]byte{corev1.TLSCertKey: testCertificate(t, now.Add(-time.Hour))}},
+		"istio-system/not-cert": {Data: map[string][]byte{corev1.TLSCertKey: []byte("garbage")}},
+	}
+	lookup := func(namespace string, name string) (*corev1.Secret, error) {
+		if secret, ok := secrets[namespace+"/"+name]; ok {
+			return secret, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	tests := []struct {
+		credential string
+		state      string
+		reason     string
+	}{
+		{credential: "valid", state: model.StateReady},
+		{credential: "expiring", state: model.StateDegraded, reason: "CertificateExpiring"},
+		{credential: "expired", state: model.StateFailed, reason: "CertificateExpired"},
+		{credential: "not-cert", state: model.StateFailed, reason: "CertificateError"},
+		{credential: "missing", state: model.StateFailed, reason: "CertificateError"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.credential, func(t *testing.T) {
+			infos := GatewayInfos([]*istionetworking.Gateway{tlsGateway(tt.credential)}, lookup, now)
+			assert.Len(t, infos, 1)
+			assert.Equal(t, tt.state, infos[0].State)
+			assert.Equal(t, tt.reason, infos[0].Reason)
+			assert.Len(t, infos[0].Servers, 2)
+			assert.Nil(t, infos[0].Servers[0].Certificate)
+			assert.Equal(t, "SIMPLE", infos[0].Servers[1].TLSMode)
+		})
+	}
+
+	infos := GatewayInfos([]*istionetworking.Gateway{tlsGateway("valid")}, lookup, now)
+	certificate := infos[0].Servers[1].Certificate
+	assert.Equal(t, "CN=todo.example.com", certificate.Subject)
+	assert.Equal(t, []string{"todo.example.com", "www.todo.example.com"}, certificate.DNSNames)
+	assert.Equal(t, 60, certificate.DaysUntilExpiry)
+	assert.False(t, certificate.Expired)
+}
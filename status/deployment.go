@@ -0,0 +1,81 @@
+package status
+
+import (
+	"fmt"
+
+	"github.com/kapetacom/insight-api/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DeploymentState derives the state of a block deployment from its conditions,
+// the progress of the current rollout and the container statuses of its pods
+func DeploymentState(deployment *appsv1.Deployment, pods []*corev1.Pod) model.InstanceState {
+	desiredReplicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desiredReplicas = *deployment.Spec.Replicas
+	}
+	readyReplicas := deployment.Status.ReadyReplicas
+	state := model.InstanceState{
+		Type:            model.TypeBlock,
+		Name:            deployment.Name,
+		BlockID:         deployment.GetObjectMeta().GetLabels()["kapeta.com/block-id"],
+		ReadyReplicas:   readyReplicas,
+		DesiredReplicas: desiredReplicas,
+	}
+	state.State, state.Reason, state.Message = deploymentState(deployment, desiredReplicas, pods)
+	return state
+}
+
+func deploymentState(deployment *appsv1.Deployment, desiredReplicas int32, pods []*corev1.Pod) (string, string, string) {
+	status := deployment.Status
+	if desiredReplicas == 0 {
+		if status.Replicas > 0 {
+			return model.StateProgressing, "ScalingDown", fmt.Sprintf("%d pods are terminating", status.Replicas)
+		}
+		return model.StateScaledToZero, "ScaledToZero", "the deployment is scaled to zero replicas"
+	}
+
+	// stuck containers are more useful to the user than the generic rollout state
+	if state, reason, message := podProblem(pods); state != "" {
+		return state, reason, message
+	}
+
+	if condition := deploymentCondition(deployment, appsv1.DeploymentProgressing); condition != nil &&
+		condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+		return model.StateFailed, condition.Reason, condition.Message
+	}
+
+	if status.ObservedGeneration < deployment.Generation {
+		return model.StateProgressing, "NewGeneration", "waiting for the new generation to be observed"
+	}
+	if status.UpdatedReplicas < desiredReplicas {
+		return model.StateProgressing, "RollingUpdate", fmt.Sprintf("%d of %d replicas have been updated", status.UpdatedReplicas, desiredReplicas)
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return model.StateProgressing, "RollingUpdate", fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)
+	}
+
+	if status.ReadyReplicas >= desiredReplicas {
+		return model.StateReady, "", ""
+	}
+	if reason, message, pending := pendingReason(pods); pending && status.ReadyReplicas == 0 {
+		return model.StatePending, reason, message
+	}
+	if status.ReadyReplicas > 0 {
+		return model.StateDegraded, "MinimumReplicasUnavailable", fmt.Sprintf("%d of %d replicas are ready", status.ReadyReplicas, desiredReplicas)
+	}
+	if condition := deploymentCondition(deployment, appsv1.DeploymentAvailable); condition != nil && condition.Status == corev1.ConditionFalse {
+		return model.StateFailed, condition.Reason, condition.Message
+	}
+	return model.StateFailed, "NoReadyReplicas", fmt.Sprintf("0 of %d replicas are ready", desiredReplicas)
+}
+
+func deploymentCondition(deployment *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
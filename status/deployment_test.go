@@ -0,0 +1,136 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testDeployment(replicas int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "my-block",
+			Generation: 2,
+			Labels:     map[string]string{"kapeta.com/block-id": "block-1"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"kapeta.com/block-id": "block-1"}},
+		},
+		Status: status,
+	}
+}
+
+func waitingPod(reason string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-block-abc", Labels: map[string]string{"kapeta.com/block-id": "block-1"}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "main",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+			}},
+		},
+	}
+}
+
+func TestDeploymentState(t *testing.T) {
+	rolledOut := appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2}
+
+	tests := []struct {
+		name       string
+		deployment *appsv1.Deployment
+		pods       []*corev1.Pod
+		state      string
+		reason     string
+	}{
+		{
+			name:       "ready",
+			deployment: testDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2}),
+			state:      model.StateReady,
+		},
+		{
+			name:       "scaled to zero",
+			deployment: testDeployment(0, appsv1.DeploymentStatus{ObservedGeneration: 2}),
+			state:      model.StateScaledToZero,
+			reason:     "ScaledToZero",
+		},
+		{
+			name:       "rolling update",
+			deployment: testDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 2}),
+			state:      model.StateProgressing,
+			reason:     "RollingUpdate",
+		},
+		{
+			name:       "new generation",
+			deployment: testDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2}),
+			state:      model.StateProgressing,
+			reason:     "NewGeneration",
+		},
+		{
+			name:       "crash looping",
+			deployment: testDeployment(2, rolledOut),
+			pods:       []*corev1.Pod{waitingPod("CrashLoopBackOff")},
+			state:      model.StateCrashLooping,
+			reason:     "CrashLoopBackOff",
+		},
+		{
+			name:       "image pull error",
+			deployment: testDeployment(2, rolledOut),
+			pods:       []*corev1.Pod{waitingPod("ImagePullBackOff")},
+			state:      model.StateImagePullError,
+			reason:     "ImagePullBackOff",
+		},
+		{
+			name:       "degraded",
+			deployment: testDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 1}),
+			state:      model.StateDegraded,
+			reason:     "MinimumReplicasUnavailable",
+		},
+		{
+			name:       "pending",
+			deployment: testDeployment(2, rolledOut),
+			pods: []*corev1.Pod{{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-block-abc"},
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodPending,
+					Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable"}},
+				},
+			}},
+			state:  model.StatePending,
+			reason: "Unschedulable",
+		},
+		{
+			name: "progress deadline exceeded",
+			deployment: testDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, Conditions: []appsv1.DeploymentCondition{{
+				Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+			}}}),
+			state:  model.StateFailed,
+			reason: "ProgressDeadlineExceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := DeploymentState(tt.deployment, tt.pods)
+			assert.Equal(t, tt.state, state.State)
+			assert.Equal(t, tt.reason, state.Reason)
+			assert.Equal(t, "block-1", state.BlockID)
+			assert.Equal(t, "block", state.Type)
+		})
+	}
+}
+
+func TestPodsForSelector(t *testing.T) {
+	pods := []*corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"kapeta.com/block-id": "block-1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: map[string]string{"kapeta.com/block-id": "block-2"}}},
+	}
+	selected := PodsForSelector(&metav1.LabelSelector{MatchLabels: map[string]string{"kapeta.com/block-id": "block-1"}}, pods)
+	assert.Len(t, selected, 1)
+	assert.Equal(t, "a", selected[0].Name)
+	assert.Empty(t, PodsForSelector(&metav1.LabelSelector{}, pods))
+}
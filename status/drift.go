@@ -0,0 +1,168 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Workload is a deployment, statefulset or daemonset running in the services namespace
+type Workload struct {
+	Kind    string
+	Name    string
+	BlockID string
+	// Image is the image of the main container
+	Image string
+}
+
+// BackingCheck tells if an operator service has a database behind it, known is false if that can't be determined
+type BackingCheck func(svc kapetamodel.DeploymentServiceInstance) (exists bool, known bool)
+
+// Workloads returns the workloads of the deployments, statefulsets and daemonsets
+func Workloads(deployments []*appsv1.Deployment, statefulSets []*appsv1.StatefulSet, daemonSets []*appsv1.DaemonSet) []Workload {
+	result := []Workload{}
+	for _, d := range deployments {
+		result = append(result, Workload{Kind: "Deployment", Name: d.Name, BlockID: d.Labels["kapeta.com/block-id"], Image: mainImage(d.Spec.Template.Spec)})
+	}
+	for _, sts := range statefulSets {
+		result = append(result, Workload{Kind: "StatefulSet", Name: sts.Name, BlockID: sts.Labels["kapeta.com/block-id"], Image: mainImage(sts.Spec.Template.Spec)})
+	}
+	for _, ds := range daemonSets {
+		result = append(result, Workload{Kind: "DaemonSet", Name: ds.Name, BlockID: ds.Labels["kapeta.com/block-id"], Image: mainImage(ds.Spec.Template.Spec)})
+	}
+	return result
+}
+
+// DetectDrift compares the services of the deployment descriptor with the workloads in the cluster. Blocks are
+// compared by image when the descriptor has one, otherwise the image tag has to match the version of the block.
+func DetectDrift(deployment *kapetamodel.Deployment, workloads []Workload, hasBacking BackingCheck) []model.DriftItem {
+	drift := []model.DriftItem{}
+	planned := map[string]bool{}
+	byBlock := map[string][]Workload{}
+	for _, w := range workloads {
+		byBlock[w.BlockID] = append(byBlock[w.BlockID], w)
+	}
+
+	for _, svc := range deployment.Spec.Services {
+		planned[svc.Id] = true
+		if svc.Type == kapetamodel.Operator {
+			exists, known := hasBacking(svc)
+			if known && !exists {
+				drift = append(drift, model.DriftItem{
+					Kind:    model.DriftMissingOperatorResource,
+					ID:      svc.Id,
+					Name:    serviceTitle(svc),
+					Message: fmt.Sprintf("no database found for %v service %v", svc.Kind, serviceTitle(svc)),
+				})
+			}
+			continue
+		}
+
+		running := byBlock[svc.Id]
+		if len(running) == 0 {
+			drift = append(drift, model.DriftItem{
+				Kind:     model.DriftMissingFromCluster,
+				ID:       svc.Id,
+				Name:     serviceTitle(svc),
+				Expected: svc.Ref,
+				Message:  fmt.Sprintf("block %v is not running in the cluster", serviceTitle(svc)),
+			})
+			continue
+		}
+		for _, w := range running {
+			if item, ok := imageDrift(svc, w); ok {
+				drift = append(drift, item)
+			}
+		}
+	}
+
+	for _, w := range workloads {
+		if w.BlockID != "" && planned[w.BlockID] {
+			continue
+		}
+		drift = append(drift, model.DriftItem{
+			Kind:    model.DriftNotInPlan,
+			ID:      w.BlockID,
+			Name:    w.Name,
+			Actual:  w.Image,
+			Message: fmt.Sprintf("%v %v is not part of the plan", strings.ToLower(w.Kind), w.Name),
+		})
+	}
+	return drift
+}
+
+func imageDrift(svc kapetamodel.DeploymentServiceInstance, w Workload) (model.DriftItem, bool) {
+	if svc.Image != nil && *svc.Image != "" {
+		if stripDigest(*svc.Image) == stripDigest(w.Image) {
+			return model.DriftItem{}, false
+		}
+		return model.DriftItem{
+			Kind:     model.DriftImageMismatch,
+			ID:       svc.Id,
+			Name:     w.Name,
+			Expected: *svc.Image,
+			Actual:   w.Image,
+			Message:  fmt.Sprintf("%v %v runs %v instead of %v", strings.ToLower(w.Kind), w.Name, w.Image, *svc.Image),
+		}, true
+	}
+	version := refVersion(svc.Ref)
+	tag := imageTag(w.Image)
+	// local and latest references can't be compared to a tag
+	if version == "" || version == "local" || version == "latest" || tag == "" || tag == version {
+		return model.DriftItem{}, false
+	}
+	return model.DriftItem{
+		Kind:     model.DriftVersionMismatch,
+		ID:       svc.Id,
+		Name:     w.Name,
+		Expected: version,
+		Actual:   tag,
+		Message:  fmt.Sprintf("%v %v runs version %v instead of %v", strings.ToLower(w.Kind), w.Name, tag, version),
+	}, true
+}
+
+// mainImage returns the image of the container named main, or of the first container
+func mainImage(spec corev1.PodSpec) string {
+	for _, c := range spec.Containers {
+		if c.Name == "main" {
+			return c.Image
+		}
+	}
+	if len(spec.Containers) > 0 {
+		return spec.Containers[0].Image
+	}
+	return ""
+}
+
+// refVersion returns the version of a reference like kapeta/todo:1.2.3
+func refVersion(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i >= 0 {
+		return ref[i+1:]
+	}
+	return ""
+}
+
+// imageTag returns the tag of an image, ignoring the port of the registry and the digest
+func imageTag(image string) string {
+	image = stripDigest(image)
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+func stripDigest(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	return image
+}
+
+func serviceTitle(svc kapetamodel.DeploymentServiceInstance) string {
+	if svc.Title != nil && *svc.Title != "" {
+		return *svc.Title
+	}
+	return svc.Ref
+}
@@ -0,0 +1,113 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func planService(id string, ref string, image string) kapetamodel.DeploymentServiceInstance {
+	svc := kapetamodel.DeploymentServiceInstance{Id: id, Kind: "kapeta/block-type-service", Ref: ref, Type: kapetamodel.DeploymentServiceInstanceTypeService}
+	if image != "" {
+		svc.Image = &image
+	}
+	return svc
+}
+
+func TestWorkloads(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "todo", Labels: map[string]string{"kapeta.com/block-id": "block-1"}}}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "sidecar", Image: "envoy:1.0"}, {Name: "main", Image: "kapeta/todo:1.0.0"}}
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "cache"}}
+	statefulSet.Spec.Template.Spec.Containers = []corev1.Container{{Name: "redis", Image: "redis:7"}}
+
+	workloads := Workloads([]*appsv1.Deployment{deployment}, []*appsv1.StatefulSet{statefulSet}, nil)
+	assert.Equal(t, []Workload{
+		{Kind: "Deployment", Name: "todo", BlockID: "block-1", Image: "kapeta/todo:1.0.0"},
+		{Kind: "StatefulSet", Name: "cache", Image: "redis:7"},
+	}, workloads)
+}
+
+func TestDetectDrift(t *testing.T) {
+	database := kapetamodel.DeploymentServiceInstance{Id: "db-1", Kind: "kapeta/resource-type-postgresql", Ref: "kapeta/postgresql:1.0.0", Type: kapetamodel.Operator}
+
+	tests := []struct {
+		name      string
+		services  []kapetamodel.DeploymentServiceInstance
+		workloads []Workload
+		backing   [2]bool
+		kinds     []string
+	}{
+		{
+			name:      "in sync",
+			services:  []kapetamodel.DeploymentServiceInstance{planService("block-1", "kapeta/todo:1.0.0", ""), database},
+			workloads: []Workload{{Kind: "Deployment", Name: "todo", BlockID: "block-1", Image: "registry:5000/kapeta/todo:1.0.0"}},
+			backing:   [2]bool{true, true},
+			kinds:     []string{},
+		},
+		{
+			name:     "missing from cluster",
+			services: []kapetamodel.DeploymentServiceInstance{planService("block-1", "kapeta/todo:1.0.0", "")},
+			kinds:    []string{model.DriftMissingFromCluster},
+		},
+		{
+			name:      "not in plan",
+			workloads: []Workload{{Kind: "Deployment", Name: "legacy", Image: "legacy:1"}, {Kind: "Deployment", Name: "old", BlockID: "block-9"}},
+			kinds:     []string{model.DriftNotInPlan, model.DriftNotInPlan},
+		},
+		{
+			name:      "version mismatch",
+			services:  []kapetamodel.DeploymentServiceInstance{planService("block-1", "kapeta/todo:1.1.0", "")},
+			workloads: []Workload{{Kind: "Deployment", Name: "todo", BlockID: "block-1", Image: "kapeta/todo:1.0.0"}},
+			kinds:     []string{model.DriftVersionMismatch},
+		},
+		{
+			name:      "local versions are not compared",
+			services:  []kapetamodel.DeploymentServiceInstance{planService("block-1", "kapeta/todo:local", "")},
+			workloads: []Workload{{Kind: "Deployment", Name: "todo", BlockID: "block-1", Image: "kapeta/todo:abc123"}},
+			kinds:     []string{},
+		},
+		{
+			name:      "image mismatch",
+			services:  []kapetamodel.DeploymentServiceInstance{planService("block-1", "kapeta/todo:1.0.0", "kapeta/todo:abc")},
+			workloads: []Workload{{Kind: "Deployment", Name: "todo", BlockID: "block-1", Image: "kapeta/todo:def"}},
+			kinds:     []string{model.DriftImageMismatch},
+		},
+		{
+			name:      "image digest is ignored",
+			services:  []kapetamodel.DeploymentServiceInstance{planService("block-1", "kapeta/todo:1.0.0", "kapeta/todo:abc")},
+			workloads: []Workload{{Kind: "Deployment", Name: "todo", BlockID: "block-1", Image: "kapeta/todo:abc@sha256:1234"}},
+			kinds:     []string{},
+		},
+		{
+			name:     "missing database",
+			services: []kapetamodel.DeploymentServiceInstance{database},
+			backing:  [2]bool{false, true},
+			kinds:    []string{model.DriftMissingOperatorResource},
+		},
+		{
+			name:     "unknown database",
+			services: []kapetamodel.DeploymentServiceInstance{database},
+			backing:  [2]bool{false, false},
+			kinds:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := &kapetamodel.Deployment{}
+			deployment.Spec.Services = tt.services
+			drift := DetectDrift(deployment, tt.workloads, func(svc kapetamodel.DeploymentServiceInstance) (bool, bool) {
+				return tt.backing[0], tt.backing[1]
+			})
+			kinds := []string{}
+			for _, item := range drift {
+				kinds = append(kinds, item.Kind)
+			}
+			assert.Equal(t, tt.kinds, kinds)
+		})
+	}
+}
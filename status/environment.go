@@ -0,0 +1,134 @@
+package status
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/kapetacom/insight-api/kubernetes"
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EnvironmentInfo returns the environment, plan and target of the cluster from the
+// labels of the kapeta secret with the newest environment version, ErrVersionNotFound is
+// returned when no environment is stored
+func EnvironmentInfo(secrets []*corev1.Secret) (*model.ClusterStatus, error) {
+	if len(secrets) > 0 {
+		status := &model.ClusterStatus{}
+		secret := kubernetes.LatestSecret(secrets)
+		labels := secret.GetObjectMeta().GetLabels()
+		status.EnvironmentName = labels["kapeta.com/environment-name"]
+		status.EnvironmentVersion = labels["kapeta.com/environment-version"]
+
+		status.PlanName = labels["kapeta.com/plan-name"]
+		status.PlanVersion = labels["kapeta.com/plan-version"]
+
+		status.TargetName = labels["kapeta.com/deployment-target-name"]
+		status.TargetVersion = labels["kapeta.com/deployment-target-version"]
+		return status, nil
+	}
+	return nil, fmt.Errorf("%w: no environment versions are stored", ErrVersionNotFound)
+}
+
+// EnvironmentVersions lists the stored versions of the environment from the newest to the oldest
+func EnvironmentVersions(secrets []*corev1.Secret) []model.EnvironmentVersion {
+	result := []model.EnvironmentVersion{}
+	for i, secret := range kubernetes.SortByEnvironmentVersion(secrets) {
+		labels := secret.GetLabels()
+		result = append(result, model.EnvironmentVersion{
+			EnvironmentName:    labels["kapeta.com/environment-name"],
+			EnvironmentVersion: labels["kapeta.com/environment-version"],
+			PlanName:           labels["kapeta.com/plan-name"],
+			PlanVersion:        labels["kapeta.com/plan-version"],
+			TargetName:         labels["kapeta.com/deployment-target-name"],
+			TargetVersion:      labels["kapeta.com/deployment-target-version"],
+			CreatedAt:          secret.CreationTimestamp.UnixMilli(),
+			Current:            i == 0,
+		})
+	}
+	return result
+}
+
+// DiffDeployments compares the services and configuration of two deployment descriptors
+func DiffDeployments(from *kapetamodel.Deployment, to *kapetamodel.Deployment) model.VersionDiff {
+	diff := model.VersionDiff{
+		Added:         []model.ServiceChange{},
+		Removed:       []model.ServiceChange{},
+		Changed:       []model.ServiceChange{},
+		Configuration: configChanges("", from.Spec.Configuration, to.Spec.Configuration),
+	}
+	before := map[string]kapetamodel.DeploymentServiceInstance{}
+	for _, svc := range from.Spec.Services {
+		before[svc.Id] = svc
+	}
+	after := map[string]bool{}
+	for _, svc := range to.Spec.Services {
+		after[svc.Id] = true
+		old, found := before[svc.Id]
+		if !found {
+			diff.Added = append(diff.Added, model.ServiceChange{ID: svc.Id, Name: serviceTitle(svc), Kind: svc.Kind, ToRef: svc.Ref, ToImage: stringValue(svc.Image)})
+			continue
+		}
+		change := model.ServiceChange{
+			ID:            svc.Id,
+			Name:          serviceTitle(svc),
+			Kind:          svc.Kind,
+			Configuration: configChanges("", old.Configuration, svc.Configuration),
+		}
+		if old.Ref != svc.Ref {
+			change.FromRef, change.ToRef = old.Ref, svc.Ref
+		}
+		if stringValue(old.Image) != stringValue(svc.Image) {
+			change.FromImage, change.ToImage = stringValue(old.Image), stringValue(svc.Image)
+		}
+		if change.FromRef != "" || change.ToRef != "" || change.FromImage != "" || change.ToImage != "" || len(change.Configuration) > 0 {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for _, svc := range from.Spec.Services {
+		if !after[svc.Id] {
+			diff.Removed = append(diff.Removed, model.ServiceChange{ID: svc.Id, Name: serviceTitle(svc), Kind: svc.Kind, FromRef: svc.Ref, FromImage: stringValue(svc.Image)})
+		}
+	}
+	return diff
+}
+
+// configChanges returns the keys that differ between two configurations, nested objects are
+// compared key by key and reported as dotted paths
+func configChanges(prefix string, from map[string]interface{}, to map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+	changes := []string{}
+	for key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		fromMap, fromIsMap := fromValue.(map[string]interface{})
+		toMap, toIsMap := toValue.(map[string]interface{})
+		switch {
+		case inFrom && inTo && fromIsMap && toIsMap:
+			changes = append(changes, configChanges(path, fromMap, toMap)...)
+		case inFrom != inTo || !reflect.DeepEqual(fromValue, toValue):
+			changes = append(changes, path)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,101 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func versionSecret(name string, version string, created time.Time, config string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "kapeta",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels: map[string]string{
+				"kapeta.com/environment-name":    "production",
+				"kapeta.com/environment-version": version,
+			},
+		},
+		Data: map[string][]byte{"config": []byte(config)},
+	}
+}
+
+func TestEnvironmentInfoNewestVersion(t *testing.T) {
+	now := time.Now()
+	secrets := []*corev1.Secret{
+		versionSecret("kapeta-9", "9", now, "{}"),
+		versionSecret("kapeta-10", "10", now.Add(-time.Hour), "{}"),
+		versionSecret("kapeta-2", "2", now.Add(-2*time.Hour), "{}"),
+	}
+	clusterStatus, err := EnvironmentInfo(secrets)
+	assert.NoError(t, err)
+	assert.Equal(t, "10", clusterStatus.EnvironmentVersion)
+
+	_, err = EnvironmentInfo(nil)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+
+	versions := EnvironmentVersions(secrets)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, []string{"10", "9", "2"}, []string{versions[0].EnvironmentVersion, versions[1].EnvironmentVersion, versions[2].EnvironmentVersion})
+	assert.True(t, versions[0].Current)
+	assert.False(t, versions[1].Current)
+	assert.Equal(t, now.Add(-time.Hour).UnixMilli(), versions[0].CreatedAt)
+}
+
+func TestDiffDeployments(t *testing.T) {
+	image := "kapeta/users:abc"
+	from := &kapetamodel.Deployment{}
+	from.Spec.Configuration = map[string]interface{}{"region": "eu", "smtp": map[string]interface{}{"host": "a", "port": float64(25)}}
+	from.Spec.Services = []kapetamodel.DeploymentServiceInstance{
+		{Id: "block-1", Kind: "kapeta/block-type-service", Ref: "kapeta/todo:1.0.0", Configuration: map[string]interface{}{"workers": float64(2)}},
+		{Id: "block-2", Kind: "kapeta/block-type-service", Ref: "kapeta/users:1.0.0"},
+		{Id: "block-3", Kind: "kapeta/block-type-service", Ref: "kapeta/legacy:1.0.0"},
+	}
+	to := &kapetamodel.Deployment{}
+	to.Spec.Configuration = map[string]interface{}{"region": "eu", "smtp": map[string]interface{}{"host": "b", "port": float64(25)}, "debug": true}
+	to.Spec.Services = []kapetamodel.DeploymentServiceInstance{
+		{Id: "block-1", Kind: "kapeta/block-type-service", Ref: "kapeta/todo:1.0.0", Configuration: map[string]interface{}{"workers": float64(4)}},
+		{Id: "block-2", Kind: "kapeta/block-type-service", Ref: "kapeta/users:1.1.0", Image: &image},
+		{Id: "block-4", Kind: "kapeta/block-type-web-page", Ref: "kapeta/web:1.0.0"},
+	}
+
+	diff := DiffDeployments(from, to)
+	assert.Equal(t, []string{"debug", "smtp.host"}, diff.Configuration)
+	assert.Equal(t, []model.ServiceChange{{ID: "block-4", Name: "kapeta/web:1.0.0", Kind: "kapeta/block-type-web-page", ToRef: "kapeta/web:1.0.0"}}, diff.Added)
+	assert.Equal(t, []model.ServiceChange{{ID: "block-3", Name: "kapeta/legacy:1.0.0", Kind: "kapeta/block-type-service", FromRef: "kapeta/legacy:1.0.0"}}, diff.Removed)
+	assert.Equal(t, []model.ServiceChange{
+		{ID: "block-1", Name: "kapeta/todo:1.0.0", Kind: "kapeta/block-type-service", Configuration: []string{"workers"}},
+		{ID: "block-2", Name: "kapeta/users:1.1.0", Kind: "kapeta/block-type-service", FromRef: "kapeta/users:1.0.0", ToRef: "kapeta/users:1.1.0", ToImage: image, Configuration: []string{}},
+	}, diff.Changed)
+}
+
+func TestCacheVersionDiff(t *testing.T) {
+	now := time.Now()
+	c := startTestCache(t, []runtime.Object{
+		versionSecret("kapeta-1", "1", now.Add(-time.Hour), `{"spec": {"services": [{"id": "block-1", "ref": "kapeta/todo:1.0.0"}]}}`),
+		versionSecret("kapeta-2", "2", now, `{"spec": {"services": [{"id": "block-1", "ref": "kapeta/todo:1.0.0"}, {"id": "block-2", "ref": "kapeta/users:1.0.0"}]}}`),
+	}, nil)
+
+	diff, err := c.VersionDiff("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", diff.From)
+	assert.Equal(t, "2", diff.To)
+	assert.Len(t, diff.Added, 1)
+	assert.Empty(t, diff.Removed)
+
+	diff, err = c.VersionDiff("2", "1")
+	assert.NoError(t, err)
+	assert.Len(t, diff.Removed, 1)
+
+	_, err = c.VersionDiff("", "1")
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+	_, err = c.VersionDiff("7", "")
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+}
@@ -0,0 +1,200 @@
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kapetacom/insight-api/model"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworking "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// GatewayStates returns the state of the ingress routes defined by the virtual services, a gateway
+// is ready when every destination service exists and has ready endpoints. Destinations outside of
+// the given services, e.g. in other namespaces or external hosts, are not checked.
+func GatewayStates(virtualServices []*istionetworking.VirtualService, services []*corev1.Service, endpointSlices []*discoveryv1.EndpointSlice) []model.InstanceState {
+	index := newServiceIndex(services, endpointSlices)
+	result := []model.InstanceState{}
+	for _, vs := range virtualServices {
+		state := model.InstanceState{
+			Type:     model.TypeGateway,
+			Name:     vs.GetName(),
+			BlockID:  vs.GetObjectMeta().GetLabels()["kapeta.com/block-id"],
+			Metadata: map[string]string{"kapeta.com/provider": "istio"},
+		}
+		paths := routePaths(&vs.Spec)
+		if len(paths) > 0 {
+			// the first path is kept under the old key for existing clients
+			state.Metadata["kapeta.com/api_path"] = paths[0]
+			state.Metadata["kapeta.com/api_paths"] = strings.Join(paths, ",")
+		}
+
+		hosts := destinationHosts(&vs.Spec)
+		if len(hosts) == 0 {
+			state.State, state.Reason, state.Message = model.StateFailed, "NoRoutes", "the virtual service has no routes with a destination"
+			result = append(result, state)
+			continue
+		}
+		state.Metadata["kapeta.com/destinations"] = strings.Join(hosts, ",")
+
+		backends := []string{}
+		for _, host := range hosts {
+			if namespace, name, ok := serviceForHost(host, vs.Namespace); ok {
+				backends = append(backends, namespace+"/"+name)
+			}
+		}
+		state.State, state.Reason, state.Message = index.check(backends)
+		result = append(result, state)
+	}
+	return result
+}
+
+// serviceIndex resolves backends to services, their ready endpoints and their blocks
+type serviceIndex struct {
+	services   map[string]*corev1.Service
+	namespaces map[string]bool
+	ready      map[string]int
+}
+
+func newServiceIndex(services []*corev1.Service, endpointSlices []*discoveryv1.EndpointSlice) *serviceIndex {
+	index := &serviceIndex{
+		services:   map[string]*corev1.Service{},
+		namespaces: map[string]bool{},
+		ready:      readyEndpoints(endpointSlices),
+	}
+	for _, svc := range services {
+		index.services[svc.Namespace+"/"+svc.Name] = svc
+		index.namespaces[svc.Namespace] = true
+	}
+	return index
+}
+
+// check returns the state of a gateway routing to the backends given as namespace/name, only
+// backends in a namespace we know are checked, the services namespace of the blocks always is
+func (index *serviceIndex) check(backends []string) (string, string, string) {
+	problems := []string{}
+	reason := ""
+	checked := 0
+	for _, key := range backends {
+		namespace, name, _ := strings.Cut(key, "/")
+		if !index.namespaces[namespace] && namespace != "services" {
+			continue
+		}
+		checked++
+		if index.services[key] == nil {
+			reason = "ServiceNotFound"
+			problems = append(problems, fmt.Sprintf("service %v does not exist", name))
+		} else if index.ready[key] == 0 {
+			if reason == "" {
+				reason = "NoReadyEndpoints"
+			}
+			problems = append(problems, fmt.Sprintf("service %v has no ready endpoints", name))
+		}
+	}
+	switch {
+	case len(problems) == 0:
+		return model.StateReady, "", ""
+	case len(problems) < checked:
+		return model.StateDegraded, reason, strings.Join(problems, ", ")
+	}
+	return model.StateFailed, reason, strings.Join(problems, ", ")
+}
+
+// blockID returns the block behind the service given as namespace/name
+func (index *serviceIndex) blockID(key string) string {
+	if svc := index.services[key]; svc != nil {
+		return svc.Labels["kapeta.com/block-id"]
+	}
+	return ""
+}
+
+// routePaths returns the uri of every http match, a route without matches catches everything
+func routePaths(spec *networkingv1beta1.VirtualService) []string {
+	paths := []string{}
+	for _, route := range spec.GetHttp() {
+		if len(route.GetMatch()) == 0 {
+			paths = append(paths, "/")
+			continue
+		}
+		for _, match := range route.GetMatch() {
+			uri := match.GetUri()
+			switch {
+			case uri.GetPrefix() != "":
+				paths = append(paths, uri.GetPrefix())
+			case uri.GetExact() != "":
+				paths = append(paths, uri.GetExact())
+			case uri.GetRegex() != "":
+				paths = append(paths, uri.GetRegex())
+			}
+		}
+	}
+	return paths
+}
+
+// destinationHosts returns the distinct destination hosts of the http, tls and tcp routes
+func destinationHosts(spec *networkingv1beta1.VirtualService) []string {
+	seen := map[string]bool{}
+	add := func(destination *networkingv1beta1.Destination) {
+		if host := destination.GetHost(); host != "" {
+			seen[host] = true
+		}
+	}
+	for _, route := range spec.GetHttp() {
+		for _, destination := range route.GetRoute() {
+			add(destination.GetDestination())
+		}
+		add(route.GetMirror())
+	}
+	for _, route := range spec.GetTls() {
+		for _, destination := range route.GetRoute() {
+			add(destination.GetDestination())
+		}
+	}
+	for _, route := range spec.GetTcp() {
+		for _, destination := range route.GetRoute() {
+			add(destination.GetDestination())
+		}
+	}
+	hosts := []string{}
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// serviceForHost resolves a destination host like todo, todo.services or
+// todo.services.svc.cluster.local to the namespace and name of the service
+func serviceForHost(host string, namespace string) (string, string, bool) {
+	host = strings.TrimSuffix(host, ".cluster.local")
+	host = strings.TrimSuffix(host, ".svc")
+	parts := strings.Split(host, ".")
+	switch len(parts) {
+	case 1:
+		return namespace, parts[0], true
+	case 2:
+		return parts[1], parts[0], true
+	}
+	return "", "", false
+}
+
+// readyEndpoints counts the ready endpoints of each service by namespace/name
+func readyEndpoints(endpointSlices []*discoveryv1.EndpointSlice) map[string]int {
+	ready := map[string]int{}
+	for _, slice := range endpointSlices {
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name == "" {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			// a nil ready condition has to be interpreted as ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready[slice.Namespace+"/"+name]++
+			}
+		}
+	}
+	return ready
+}
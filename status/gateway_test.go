@@ -0,0 +1,115 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworking "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func virtualService(http []*networkingv1beta1.HTTPRoute, tcp []*networkingv1beta1.TCPRoute) *istionetworking.VirtualService {
+	return &istionetworking.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Name: "todo-gateway", Namespace: "services"},
+		Spec:       networkingv1beta1.VirtualService{Http: http, Tcp: tcp},
+	}
+}
+
+func vsRoute(prefix string, hosts ...string) *networkingv1beta1.HTTPRoute {
+	route := &networkingv1beta1.HTTPRoute{}
+	if prefix != "" {
+		route.Match = []*networkingv1beta1.HTTPMatchRequest{{Uri: &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Prefix{Prefix: prefix}}}}
+	}
+	for _, host := range hosts {
+		route.Route = append(route.Route, &networkingv1beta1.HTTPRouteDestination{Destination: &networkingv1beta1.Destination{Host: host}})
+	}
+	return route
+}
+
+func endpointSlice(service string, ready bool) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: service + "-abc", Namespace: "services", Labels: map[string]string{discoveryv1.LabelServiceName: service}},
+		Endpoints:  []discoveryv1.Endpoint{{Conditions: discoveryv1.EndpointConditions{Ready: &ready}}},
+	}
+}
+
+func TestGatewayStates(t *testing.T) {
+	services := []*corev1.Service{blockService("todo", "block-1"), blockService("users", "block-2")}
+	slices := []*discoveryv1.EndpointSlice{endpointSlice("todo", true), endpointSlice("users", false)}
+
+	tests := []struct {
+		name   string
+		http   []*networkingv1beta1.HTTPRoute
+		tcp    []*networkingv1beta1.TCPRoute
+		state  string
+		reason string
+		paths  string
+	}{
+		{
+			name:  "ready",
+			http:  []*networkingv1beta1.HTTPRoute{vsRoute("/api", "todo"), vsRoute("/web", "todo.services.svc.cluster.local")},
+			state: model.StateReady,
+			paths: "/api,/web",
+		},
+		{
+			name:   "no ready endpoints",
+			http:   []*networkingv1beta1.HTTPRoute{vsRoute("/api", "todo"), vsRoute("/users", "users")},
+			state:  model.StateDegraded,
+			reason: "NoReadyEndpoints",
+			paths:  "/api,/users",
+		},
+		{
+			name:   "missing service",
+			http:   []*networkingv1beta1.HTTPRoute{vsRoute("/api", "orders.services")},
+			state:  model.StateFailed,
+			reason: "ServiceNotFound",
+			paths:  "/api",
+		},
+		{
+			name:  "route without match",
+			http:  []*networkingv1beta1.HTTPRoute{vsRoute("", "todo")},
+			state: model.StateReady,
+			paths: "/",
+		},
+		{
+			name: "tcp route and external host",
+			tcp: []*networkingv1beta1.TCPRoute{{
+				Route: []*networkingv1beta1.RouteDestination{{Destination: &networkingv1beta1.Destination{Host: "todo"}}, {Destination: &networkingv1beta1.Destination{Host: "api.example.com"}}},
+			}},
+			state: model.StateReady,
+		},
+		{
+			name:   "missing service and external host",
+			http:   []*networkingv1beta1.HTTPRoute{vsRoute("/api", "users"), vsRoute("/docs", "docs.example.com")},
+			state:  model.StateFailed,
+			reason: "NoReadyEndpoints",
+			paths:  "/api,/docs",
+		},
+		{
+			name:   "empty spec",
+			state:  model.StateFailed,
+			reason: "NoRoutes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := GatewayStates([]*istionetworking.VirtualService{virtualService(tt.http, tt.tcp)}, services, slices)
+			assert.Len(t, states, 1)
+			assert.Equal(t, tt.state, states[0].State)
+			assert.Equal(t, tt.reason, states[0].Reason)
+			assert.Equal(t, tt.paths, states[0].Metadata["kapeta.com/api_paths"])
+		})
+	}
+}
+
+func TestGatewayStatesWithoutServices(t *testing.T) {
+	// the services namespace is checked even when it has no services at all
+	states := GatewayStates([]*istionetworking.VirtualService{virtualService([]*networkingv1beta1.HTTPRoute{vsRoute("/api", "todo")}, nil)}, nil, nil)
+	assert.Len(t, states, 1)
+	assert.Equal(t, model.StateFailed, states[0].State)
+	assert.Equal(t, "ServiceNotFound", states[0].Reason)
+}
@@ -0,0 +1,215 @@
+package status
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const GatewayAPIGroupVersion = "gateway.networking.k8s.io/v1"
+
+// The Gateway API resources read through the dynamic client
+var (
+	HTTPRouteResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+	GatewayResource   = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+)
+
+// the parts of the Gateway API resources we report on, decoded from the unstructured objects
+type parentReference struct {
+	Group       string `json:"group,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name"`
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type backendReference struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+type httpRoute struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ParentRefs []parentReference `json:"parentRefs"`
+		Hostnames  []string          `json:"hostnames"`
+		Rules      []struct {
+			Matches []struct {
+				Path *struct {
+					Value string `json:"value"`
+				} `json:"path"`
+			} `json:"matches"`
+			BackendRefs []backendReference `json:"backendRefs"`
+		} `json:"rules"`
+	} `json:"spec"`
+	Status struct {
+		Parents []struct {
+			ParentRef  parentReference    `json:"parentRef"`
+			Conditions []metav1.Condition `json:"conditions"`
+		} `json:"parents"`
+	} `json:"status"`
+}
+
+type gateway struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Status            struct {
+		Conditions []metav1.Condition `json:"conditions"`
+	} `json:"status"`
+}
+
+// GatewayAPIStates returns the state of the HTTPRoutes, a route is ready when every gateway it is
+// attached to has accepted it and is programmed, and its backend services have ready endpoints
+func GatewayAPIStates(routes []runtime.Object, gateways []runtime.Object, services []*corev1.Service, endpointSlices []*discoveryv1.EndpointSlice) []model.InstanceState {
+	index := newServiceIndex(services, endpointSlices)
+	programmed := map[string]*metav1.Condition{}
+	for _, obj := range gateways {
+		gw := gateway{}
+		if decode(obj, &gw) != nil {
+			continue
+		}
+		programmed[gw.Namespace+"/"+gw.Name] = meta.FindStatusCondition(gw.Status.Conditions, "Programmed")
+	}
+
+	result := []model.InstanceState{}
+	for _, obj := range routes {
+		route := httpRoute{}
+		if decode(obj, &route) != nil {
+			continue
+		}
+		state := model.InstanceState{
+			Type:     model.TypeGateway,
+			Name:     route.Name,
+			BlockID:  route.Labels["kapeta.com/block-id"],
+			Metadata: map[string]string{"kapeta.com/provider": "gateway-api"},
+		}
+		if len(route.Spec.Hostnames) > 0 {
+			state.Metadata["kapeta.com/hostnames"] = strings.Join(route.Spec.Hostnames, ",")
+		}
+
+		paths := []string{}
+		backends := []string{}
+		total := 0
+		for _, rule := range route.Spec.Rules {
+			if len(rule.Matches) == 0 {
+				paths = append(paths, "/")
+			}
+			for _, match := range rule.Matches {
+				if match.Path != nil && match.Path.Value != "" {
+					paths = append(paths, match.Path.Value)
+				} else {
+					paths = append(paths, "/")
+				}
+			}
+			for _, ref := range rule.BackendRefs {
+				total++
+				// only services can be checked, other kinds count as unknown destinations
+				if (ref.Group != "" && ref.Group != "core") || (ref.Kind != "" && ref.Kind != "Service") {
+					continue
+				}
+				key := defaultString(ref.Namespace, route.Namespace) + "/" + ref.Name
+				if !slices.Contains(backends, key) {
+					backends = append(backends, key)
+				}
+			}
+		}
+		if len(paths) > 0 {
+			state.Metadata["kapeta.com/api_path"] = paths[0]
+			state.Metadata["kapeta.com/api_paths"] = strings.Join(paths, ",")
+		}
+		if len(backends) > 0 {
+			state.Metadata["kapeta.com/destinations"] = strings.Join(backends, ",")
+			if state.BlockID == "" {
+				state.BlockID = index.blockID(backends[0])
+			}
+		}
+		if total == 0 {
+			state.State, state.Reason, state.Message = model.StateFailed, "NoRoutes", "the route has no backends"
+		} else {
+			state.State, state.Reason, state.Message = index.check(backends)
+		}
+
+		parents := []string{}
+		accepted, allProgrammed := true, true
+		for _, parent := range route.Spec.ParentRefs {
+			key := defaultString(parent.Namespace, route.Namespace) + "/" + parent.Name
+			parents = append(parents, key)
+			conditions := parentConditions(&route, parent)
+			if !meta.IsStatusConditionTrue(conditions, "Accepted") {
+				accepted = false
+			}
+			if condition := programmed[key]; condition == nil || condition.Status != metav1.ConditionTrue {
+				allProgrammed = false
+			}
+			reason, message, pending := parentProblem(conditions, key, programmed)
+			switch {
+			case reason != "" && !pending:
+				state.State, state.Reason, state.Message = model.StateFailed, reason, message
+			case reason != "" && state.State == model.StateReady:
+				state.State, state.Reason, state.Message = model.StateProgressing, reason, message
+			}
+		}
+		if len(parents) > 0 {
+			state.Metadata["kapeta.com/gateways"] = strings.Join(parents, ",")
+			state.Metadata["kapeta.com/accepted"] = fmt.Sprint(accepted)
+			state.Metadata["kapeta.com/programmed"] = fmt.Sprint(allProgrammed)
+		}
+		result = append(result, state)
+	}
+	return result
+}
+
+// parentConditions returns the conditions the parent gateway reported for the route,
+// nil if the gateway hasn't seen the route yet
+func parentConditions(route *httpRoute, parent parentReference) []metav1.Condition {
+	for _, status := range route.Status.Parents {
+		ref := status.ParentRef
+		if ref.Name == parent.Name && ref.SectionName == parent.SectionName &&
+			defaultString(ref.Namespace, route.Namespace) == defaultString(parent.Namespace, route.Namespace) {
+			return status.Conditions
+		}
+	}
+	return nil
+}
+
+// parentProblem checks the conditions of the route and whether the gateway itself is
+// programmed, pending is true if the gateway just hasn't gotten to the route yet
+func parentProblem(conditions []metav1.Condition, key string, programmed map[string]*metav1.Condition) (string, string, bool) {
+	if conditions == nil {
+		return "Pending", fmt.Sprintf("the route has not been accepted by gateway %v yet", key), true
+	}
+	for _, conditionType := range []string{"Accepted", "ResolvedRefs"} {
+		if condition := meta.FindStatusCondition(conditions, conditionType); condition != nil && condition.Status == metav1.ConditionFalse {
+			return condition.Reason, fmt.Sprintf("gateway %v: %v", key, condition.Message), false
+		}
+	}
+	if condition := programmed[key]; condition != nil && condition.Status != metav1.ConditionTrue {
+		return "GatewayNotProgrammed", fmt.Sprintf("gateway %v is not programmed: %v", key, condition.Message), condition.Status == metav1.ConditionUnknown
+	}
+	return "", "", false
+}
+
+func decode(obj runtime.Object, into interface{}) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, into)
+}
+
+func defaultString(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,91 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testHTTPRoute(name string, backend string, parentConditions []interface{}) *unstructured.Unstructured {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "services"},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "public", "namespace": "gateways"}},
+			"hostnames":  []interface{}{"todo.example.com"},
+			"rules": []interface{}{map[string]interface{}{
+				"matches":     []interface{}{map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/api"}}},
+				"backendRefs": []interface{}{map[string]interface{}{"name": backend, "port": int64(80)}},
+			}},
+		},
+	}}
+	if parentConditions != nil {
+		route.Object["status"] = map[string]interface{}{"parents": []interface{}{map[string]interface{}{
+			"parentRef":      map[string]interface{}{"name": "public", "namespace": "gateways"},
+			"controllerName": "example.com/gateway",
+			"conditions":     parentConditions,
+		}}}
+	}
+	return route
+}
+
+func condition(conditionType string, status string, reason string) map[string]interface{} {
+	return map[string]interface{}{"type": conditionType, "status": status, "reason": reason, "message": reason, "lastTransitionTime": "2024-01-01T00:00:00Z"}
+}
+
+func testGateway(programmed string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "public", "namespace": "gateways"},
+		"status":     map[string]interface{}{"conditions": []interface{}{condition("Programmed", programmed, "Programmed")}},
+	}}
+}
+
+func TestGatewayAPIStates(t *testing.T) {
+	services := []*corev1.Service{blockService("todo", "block-1")}
+	slices := []*discoveryv1.EndpointSlice{endpointSlice("todo", true)}
+	accepted := []interface{}{condition("Accepted", "True", "Accepted"), condition("ResolvedRefs", "True", "ResolvedRefs")}
+
+	tests := []struct {
+		name       string
+		route      *unstructured.Unstructured
+		programmed string
+		state      string
+		reason     string
+	}{
+		{name: "ready", route: testHTTPRoute("todo", "todo", accepted), programmed: "True", state: model.StateReady},
+		{name: "not accepted yet", route: testHTTPRoute("todo", "todo", nil), programmed: "True", state: model.StateProgressing, reason: "Pending"},
+		{
+			name:       "not allowed",
+			route:      testHTTPRoute("todo", "todo", []interface{}{condition("Accepted", "False", "NotAllowedByListeners")}),
+			programmed: "True",
+			state:      model.StateFailed,
+			reason:     "NotAllowedByListeners",
+		},
+		{name: "gateway not programmed", route: testHTTPRoute("todo", "todo", accepted), programmed: "False", state: model.StateFailed, reason: "GatewayNotProgrammed"},
+		{name: "missing backend", route: testHTTPRoute("todo", "orders", accepted), programmed: "True", state: model.StateFailed, reason: "ServiceNotFound"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := GatewayAPIStates([]runtime.Object{tt.route}, []runtime.Object{testGateway(tt.programmed)}, services, slices)
+			assert.Len(t, states, 1)
+			assert.Equal(t, tt.state, states[0].State)
+			assert.Equal(t, tt.reason, states[0].Reason)
+			assert.Equal(t, "/api", states[0].Metadata["kapeta.com/api_path"])
+			assert.Equal(t, "todo.example.com", states[0].Metadata["kapeta.com/hostnames"])
+			assert.Equal(t, "gateways/public", states[0].Metadata["kapeta.com/gateways"])
+		})
+	}
+
+	states := GatewayAPIStates([]runtime.Object{testHTTPRoute("todo", "todo", accepted)}, []runtime.Object{testGateway("True")}, services, slices)
+	assert.Equal(t, "block-1", states[0].BlockID)
+	assert.Equal(t, "true", states[0].Metadata["kapeta.com/accepted"])
+	assert.Equal(t, "true", states[0].Metadata["kapeta.com/programmed"])
+}
@@ -0,0 +1,236 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8s "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// DefaultHealthPath is the health endpoint every Kapeta block serves
+	DefaultHealthPath = "/.kapeta/health"
+	// HealthPathAnnotation on the service of a block overrides the health path
+	HealthPathAnnotation = "kapeta.com/health-path"
+
+	// probes running at the same time, so a large plan doesn't flood the API server
+	maxConcurrentProbes = 10
+)
+
+// The results of a health probe
+const (
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+	HealthTimeout   = "timeout"
+)
+
+// The latency of a health probe in the status
+const (
+	HealthLatencyFast = "fast"
+	HealthLatencySlow = "slow"
+)
+
+var (
+	healthProbeInterval = 30 * time.Second
+	healthProbeTimeout  = 2 * time.Second
+	// probes answered slower than this are reported as slow
+	healthSlowLatency = 500 * time.Millisecond
+)
+
+// HealthResult is the outcome of calling the health endpoint of a block
+type HealthResult struct {
+	Health    string
+	Latency   time.Duration
+	CheckedAt time.Time
+	Error     string
+	// Dependencies is the dependency health reported by the block, if any
+	Dependencies json.RawMessage
+}
+
+// healthResponse is the part of the health response we understand, blocks may
+// report {"ok": false} with a 200 status code
+type healthResponse struct {
+	OK           *bool           `json:"ok"`
+	Dependencies json.RawMessage `json:"dependencies"`
+}
+
+// healthProber calls the health endpoint of every block through the service proxy of the
+// API server, so insight-api doesn't need network access to the services namespace
+type healthProber struct {
+	clientset k8s.Interface
+	services  corelisters.ServiceLister
+	timeout   time.Duration
+	changed   func()
+
+	mu      sync.RWMutex
+	results map[string]HealthResult
+}
+
+func newHealthProber(clientset k8s.Interface, services corelisters.ServiceLister, timeout time.Duration, changed func()) *healthProber {
+	return &healthProber{
+		clientset: clientset,
+		services:  services,
+		timeout:   timeout,
+		changed:   changed,
+		results:   map[string]HealthResult{},
+	}
+}
+
+// start probes every interval until the context is cancelled, waiting for synced to be true first
+func (p *healthProber) start(ctx context.Context, interval time.Duration, synced func() bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if synced() {
+				p.probeAll(ctx)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// probeAll probes the services of all blocks concurrently
+func (p *healthProber) probeAll(ctx context.Context) {
+	services, err := p.services.List(blockSelector)
+	if err != nil {
+		return
+	}
+	results := map[string]HealthResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentProbes)
+	for _, svc := range services {
+		blockID := svc.Labels["kapeta.com/block-id"]
+		if blockID == "" || len(svc.Spec.Ports) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(svc *corev1.Service) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result := p.probe(ctx, svc)
+			mu.Lock()
+			results[blockID] = result
+			mu.Unlock()
+		}(svc)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	changed := len(results) != len(p.results)
+	for id, result := range results {
+		if p.results[id].Health != result.Health {
+			changed = true
+		}
+	}
+	p.results = results
+	p.mu.Unlock()
+	if changed && p.changed != nil {
+		p.changed()
+	}
+}
+
+func (p *healthProber) probe(ctx context.Context, svc *corev1.Service) HealthResult {
+	path := DefaultHealthPath
+	if v := svc.Annotations[HealthPathAnnotation]; v != "" {
+		path = v
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	started := time.Now()
+	body, err := p.clientset.CoreV1().Services(svc.Namespace).ProxyGet("http", svc.Name, servicePort(svc), path, nil).DoRaw(ctx)
+	result := HealthResult{Latency: time.Since(started), CheckedAt: started}
+	if err != nil {
+		result.Health = HealthUnhealthy
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) || apierrors.IsTimeout(err) {
+			result.Health = HealthTimeout
+		}
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Health = HealthHealthy
+	response := healthResponse{}
+	// the body doesn't have to be json, a 2xx status code is enough to be healthy
+	if json.Unmarshal(body, &response) == nil {
+		if response.OK != nil && !*response.OK {
+			result.Health = HealthUnhealthy
+		}
+		result.Dependencies = response.Dependencies
+	}
+	return result
+}
+
+// lastResults returns the last probe result of each block by block id
+func (p *healthProber) lastResults() map[string]HealthResult {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.results
+}
+
+// HealthCheck returns the probe result of the block with its latency
+func HealthCheck(blockID string, result HealthResult) model.HealthCheck {
+	return model.HealthCheck{
+		BlockID:      blockID,
+		Health:       result.Health,
+		Latency:      result.Latency.Milliseconds(),
+		CheckedAt:    result.CheckedAt.UnixMilli(),
+		Error:        result.Error,
+		Dependencies: result.Dependencies,
+	}
+}
+
+// servicePort prefers the port named http and falls back to the first port
+func servicePort(svc *corev1.Service) string {
+	port := svc.Spec.Ports[0]
+	for _, p := range svc.Spec.Ports {
+		if p.Name == "http" {
+			port = p
+			break
+		}
+	}
+	if port.Name != "" {
+		return port.Name
+	}
+	return strconv.Itoa(int(port.Port))
+}
+
+// HealthLatency buckets the latency of a probe, the exact value is served with the health of the instance
+func HealthLatency(latency time.Duration) string {
+	if latency > healthSlowLatency {
+		return HealthLatencySlow
+	}
+	return HealthLatencyFast
+}
+
+// addHealth adds the probe result of the block to the metadata of the instance, the latency is
+// only reported as fast or slow and the time of the probe is left out as they would make every
+// probe a change of the status
+func addHealth(state *model.InstanceState, result HealthResult) {
+	if state.Metadata == nil {
+		state.Metadata = map[string]string{}
+	}
+	state.Metadata["kapeta.com/health"] = result.Health
+	state.Metadata["kapeta.com/health_latency"] = HealthLatency(result.Latency)
+	if result.Error != "" {
+		state.Metadata["kapeta.com/health_error"] = result.Error
+	}
+	if len(result.Dependencies) > 0 {
+		state.Metadata["kapeta.com/health_dependencies"] = string(result.Dependencies)
+	}
+}
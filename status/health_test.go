@@ -0,0 +1,96 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+type fakeResponse struct {
+	body  string
+	err   error
+	delay time.Duration
+}
+
+func (r fakeResponse) DoRaw(ctx context.Context) ([]byte, error) {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []byte(r.body), r.err
+}
+
+func (r fakeResponse) Stream(ctx context.Context) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func blockService(name string, blockID string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "services", Labels: map[string]string{"kapeta.com/block-id": blockID}},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+}
+
+func TestHealthProber(t *testing.T) {
+	responses := map[string]fakeResponse{
+		"todo":   {body: `{"ok": true, "dependencies": {"mongodb": {"ok": true}}}`},
+		"users":  {body: `{"ok": false}`},
+		"orders": {err: errors.New("no endpoints available for service \"orders\"")},
+		"slow":   {delay: time.Second},
+	}
+	clientset := fake.NewSimpleClientset()
+	paths := make(chan string, len(responses))
+	clientset.AddProxyReactor("services", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		proxy := action.(k8stesting.ProxyGetAction)
+		paths <- proxy.GetPath()
+		return true, responses[proxy.GetName()], nil
+	})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name := range responses {
+		assert.NoError(t, indexer.Add(blockService(name, name+"-id")))
+	}
+	changed := false
+	prober := newHealthProber(clientset, corelisters.NewServiceLister(indexer), 100*time.Millisecond, func() { changed = true })
+
+	started := time.Now()
+	prober.probeAll(context.Background())
+	// the probes run concurrently and the slow one is cut off by the timeout
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+	assert.True(t, changed)
+	assert.Equal(t, DefaultHealthPath, <-paths)
+
+	results := prober.lastResults()
+	assert.Equal(t, HealthHealthy, results["todo-id"].Health)
+	assert.JSONEq(t, `{"mongodb": {"ok": true}}`, string(results["todo-id"].Dependencies))
+	assert.Equal(t, HealthUnhealthy, results["users-id"].Health)
+	assert.Equal(t, HealthUnhealthy, results["orders-id"].Health)
+	assert.Contains(t, results["orders-id"].Error, "no endpoints")
+	assert.Equal(t, HealthTimeout, results["slow-id"].Health)
+
+	state := model.InstanceState{Name: "todo", BlockID: "todo-id"}
+	addHealth(&state, results["todo-id"])
+	assert.Equal(t, HealthHealthy, state.Metadata["kapeta.com/health"])
+	assert.Equal(t, HealthLatencyFast, state.Metadata["kapeta.com/health_latency"])
+	assert.Contains(t, state.Metadata["kapeta.com/health_dependencies"], "mongodb")
+
+	assert.Equal(t, HealthLatencySlow, HealthLatency(healthSlowLatency+time.Millisecond))
+
+	check := HealthCheck("todo-id", results["todo-id"])
+	assert.Equal(t, HealthHealthy, check.Health)
+	assert.Equal(t, results["todo-id"].CheckedAt.UnixMilli(), check.CheckedAt)
+	assert.JSONEq(t, `{"mongodb": {"ok": true}}`, string(check.Dependencies))
+}
@@ -0,0 +1,78 @@
+package status
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// IngressStates returns the state of the Ingress resources, an ingress is ready when its backend
+// services have ready endpoints and the controller has assigned it an address
+func IngressStates(ingresses []*networkingv1.Ingress, services []*corev1.Service, endpointSlices []*discoveryv1.EndpointSlice) []model.InstanceState {
+	index := newServiceIndex(services, endpointSlices)
+	result := []model.InstanceState{}
+	for _, ingress := range ingresses {
+		state := model.InstanceState{
+			Type:     model.TypeGateway,
+			Name:     ingress.Name,
+			BlockID:  ingress.Labels["kapeta.com/block-id"],
+			Metadata: map[string]string{"kapeta.com/provider": "ingress"},
+		}
+		if ingress.Spec.IngressClassName != nil {
+			state.Metadata["kapeta.com/ingress_class"] = *ingress.Spec.IngressClassName
+		}
+
+		hostnames := []string{}
+		paths := []string{}
+		backends := []string{}
+		addBackend := func(backend *networkingv1.IngressBackend) {
+			if backend != nil && backend.Service != nil && !slices.Contains(backends, ingress.Namespace+"/"+backend.Service.Name) {
+				backends = append(backends, ingress.Namespace+"/"+backend.Service.Name)
+			}
+		}
+		addBackend(ingress.Spec.DefaultBackend)
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" && !slices.Contains(hostnames, rule.Host) {
+				hostnames = append(hostnames, rule.Host)
+			}
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				p := path.Path
+				if p == "" {
+					p = "/"
+				}
+				paths = append(paths, p)
+				addBackend(&path.Backend)
+			}
+		}
+		if len(hostnames) > 0 {
+			state.Metadata["kapeta.com/hostnames"] = strings.Join(hostnames, ",")
+		}
+		if len(paths) > 0 {
+			state.Metadata["kapeta.com/api_path"] = paths[0]
+			state.Metadata["kapeta.com/api_paths"] = strings.Join(paths, ",")
+		}
+		if len(backends) == 0 {
+			state.State, state.Reason, state.Message = model.StateFailed, "NoRoutes", "the ingress has no service backends"
+			result = append(result, state)
+			continue
+		}
+		state.Metadata["kapeta.com/destinations"] = strings.Join(backends, ",")
+		if state.BlockID == "" {
+			state.BlockID = index.blockID(backends[0])
+		}
+
+		state.State, state.Reason, state.Message = index.check(backends)
+		if state.State == model.StateReady && len(ingress.Status.LoadBalancer.Ingress) == 0 {
+			state.State, state.Reason, state.Message = model.StateProgressing, "AddressPending", "the ingress controller has not assigned an address yet"
+		}
+		result = append(result, state)
+	}
+	return result
+}
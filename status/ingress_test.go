@@ -0,0 +1,59 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIngressStates(t *testing.T) {
+	services := []*corev1.Service{blockService("todo", "block-1"), blockService("users", "block-2")}
+	slices := []*discoveryv1.EndpointSlice{endpointSlice("todo", true), endpointSlice("users", false)}
+	pathType := networkingv1.PathTypePrefix
+	ingress := func(address bool, backends ...string) *networkingv1.Ingress {
+		ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "todo", Namespace: "services"}}
+		rule := networkingv1.IngressRule{Host: "todo.example.com", IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{}}}
+		for _, backend := range backends {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1.HTTPIngressPath{
+				Path:     "/" + backend,
+				PathType: &pathType,
+				Backend:  networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: backend}},
+			})
+		}
+		ing.Spec.Rules = []networkingv1.IngressRule{rule}
+		if address {
+			ing.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "10.0.0.1"}}
+		}
+		return ing
+	}
+
+	tests := []struct {
+		name    string
+		ingress *networkingv1.Ingress
+		state   string
+		reason  string
+	}{
+		{name: "ready", ingress: ingress(true, "todo"), state: model.StateReady},
+		{name: "no address", ingress: ingress(false, "todo"), state: model.StateProgressing, reason: "AddressPending"},
+		{name: "one backend down", ingress: ingress(true, "todo", "users"), state: model.StateDegraded, reason: "NoReadyEndpoints"},
+		{name: "no backends", ingress: ingress(true), state: model.StateFailed, reason: "NoRoutes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := IngressStates([]*networkingv1.Ingress{tt.ingress}, services, slices)
+			assert.Len(t, states, 1)
+			assert.Equal(t, tt.state, states[0].State)
+			assert.Equal(t, tt.reason, states[0].Reason)
+		})
+	}
+
+	states := IngressStates([]*networkingv1.Ingress{ingress(true, "todo", "users")}, services, slices)
+	assert.Equal(t, "block-1", states[0].BlockID)
+	assert.Equal(t, "/todo,/users", states[0].Metadata["kapeta.com/api_paths"])
+	assert.Equal(t, "todo.example.com", states[0].Metadata["kapeta.com/hostnames"])
+}
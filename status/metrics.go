@@ -0,0 +1,179 @@
+package status
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const MetricsGroupVersion = "metrics.k8s.io/v1beta1"
+
+// PodMetricsResource is read through the dynamic client, the metrics API can't be watched
+var PodMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// memory usage above this share of the limit is flagged, the container is likely to be OOMKilled
+var memoryLimitThreshold = 0.9
+
+// the part of the PodMetrics we use
+type podMetrics struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Timestamp         metav1.Time `json:"timestamp"`
+	Containers        []struct {
+		Name  string              `json:"name"`
+		Usage corev1.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+// MetricsView keeps the latest PodMetrics of the services namespace from metrics-server
+type MetricsView struct {
+	client   dynamic.Interface
+	interval time.Duration
+
+	mu      sync.RWMutex
+	pods    map[string]corev1.ResourceList
+	updated time.Time
+}
+
+func NewMetricsView(client dynamic.Interface, interval time.Duration) *MetricsView {
+	return &MetricsView{client: client, interval: interval}
+}
+
+// Start refreshes the metrics every interval until the context is cancelled
+func (v *MetricsView) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+		for {
+			v.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (v *MetricsView) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	list, err := v.client.Resource(PodMetricsResource).Namespace("services").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("error getting pod metrics: %v\n", err)
+		return
+	}
+	pods := map[string]corev1.ResourceList{}
+	updated := time.Time{}
+	for i := range list.Items {
+		metrics := podMetrics{}
+		if decode(&list.Items[i], &metrics) != nil {
+			continue
+		}
+		for _, container := range metrics.Containers {
+			pods[metrics.Name+"/"+container.Name] = container.Usage
+		}
+		if updated.IsZero() || metrics.Timestamp.Before(&metav1.Time{Time: updated}) {
+			updated = metrics.Timestamp.Time
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.pods = pods
+	v.updated = updated
+}
+
+// Usage returns the usage of every container by pod/container name and the time of the oldest metrics,
+// nil until the metrics have been read
+func (v *MetricsView) Usage() (map[string]corev1.ResourceList, time.Time) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.pods, v.updated
+}
+
+// InstanceResources compares the usage of the containers of the pods with their requests and
+// limits, usage is nil when metrics-server isn't installed
+func InstanceResources(blockID string, pods []*corev1.Pod, usage map[string]corev1.ResourceList, updated time.Time) model.InstanceResources {
+	measured := usage != nil
+	result := model.InstanceResources{
+		BlockID:        blockID,
+		MetricsEnabled: measured,
+		Pods:           []model.PodResources{},
+	}
+	if !updated.IsZero() {
+		result.UpdatedAt = updated.UnixMilli()
+	}
+	podCPU, podMemory := []model.ResourceMetric{}, []model.ResourceMetric{}
+	for _, pod := range pods {
+		podResources := model.PodResources{Name: pod.Name, Measured: measured, Containers: []model.ContainerResources{}}
+		cpu, memory := []model.ResourceMetric{}, []model.ResourceMetric{}
+		for _, container := range pod.Spec.Containers {
+			// a pod that just started has no metrics yet, that isn't the same as using nothing
+			used, reported := usage[pod.Name+"/"+container.Name]
+			containerMeasured := measured && reported
+			containerResources := model.ContainerResources{
+				Name:     container.Name,
+				Measured: containerMeasured,
+				CPU:      resourceMetric(used.Cpu().MilliValue(), container.Resources.Requests.Cpu().MilliValue(), container.Resources.Limits.Cpu().MilliValue(), containerMeasured),
+				Memory:   resourceMetric(used.Memory().Value(), container.Resources.Requests.Memory().Value(), container.Resources.Limits.Memory().Value(), containerMeasured),
+			}
+			containerResources.NearMemoryLimit = containerMeasured && nearLimit(containerResources.Memory)
+			result.NearMemoryLimit = result.NearMemoryLimit || containerResources.NearMemoryLimit
+			podResources.Measured = podResources.Measured && containerMeasured
+			cpu = append(cpu, containerResources.CPU)
+			memory = append(memory, containerResources.Memory)
+			podResources.Containers = append(podResources.Containers, containerResources)
+		}
+		podResources.CPU, podResources.Memory = sumMetrics(cpu, podResources.Measured), sumMetrics(memory, podResources.Measured)
+		// without metrics-server nothing is measured and the totals are only the requests and limits
+		if podResources.Measured || !measured {
+			podCPU, podMemory = append(podCPU, podResources.CPU), append(podMemory, podResources.Memory)
+		}
+		result.Pods = append(result.Pods, podResources)
+	}
+	result.CPU, result.Memory = sumMetrics(podCPU, measured), sumMetrics(podMemory, measured)
+	return result
+}
+
+// sumMetrics adds up the metrics, there is no limit if any of them is unlimited
+func sumMetrics(metrics []model.ResourceMetric, measured bool) model.ResourceMetric {
+	var usage, request, limit int64
+	limited := len(metrics) > 0
+	for _, metric := range metrics {
+		usage += metric.Usage
+		request += metric.Request
+		limit += metric.Limit
+		limited = limited && metric.Limit > 0
+	}
+	if !limited {
+		limit = 0
+	}
+	return resourceMetric(usage, request, limit, measured)
+}
+
+func resourceMetric(usage int64, request int64, limit int64, measured bool) model.ResourceMetric {
+	metric := model.ResourceMetric{Usage: usage, Request: request, Limit: limit}
+	if !measured {
+		return metric
+	}
+	if request > 0 {
+		percentage := float64(usage) / float64(request) * 100
+		metric.RequestPercentage = &percentage
+	}
+	if limit > 0 {
+		percentage := float64(usage) / float64(limit) * 100
+		metric.LimitPercentage = &percentage
+	}
+	return metric
+}
+
+func nearLimit(metric model.ResourceMetric) bool {
+	return metric.Limit > 0 && float64(metric.Usage) >= float64(metric.Limit)*memoryLimitThreshold
+}
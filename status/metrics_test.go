@@ -0,0 +1,106 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func resourcePod(name string, limits bool) *corev1.Pod {
+	requirements := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("100Mi")},
+	}
+	if limits {
+		requirements.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("200Mi")}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "services", Labels: map[string]string{"kapeta.com/block-id": "block-1"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Resources: requirements}}},
+	}
+}
+
+func TestInstanceResources(t *testing.T) {
+	updated := time.Now()
+	usage := map[string]corev1.ResourceList{
+		"todo-1/main": {corev1.ResourceCPU: resource.MustParse("50m"), corev1.ResourceMemory: resource.MustParse("190Mi")},
+		"todo-2/main": {corev1.ResourceCPU: resource.MustParse("150m"), corev1.ResourceMemory: resource.MustParse("50Mi")},
+	}
+
+	resources := InstanceResources("block-1", []*corev1.Pod{resourcePod("todo-1", true), resourcePod("todo-2", true)}, usage, updated)
+	assert.True(t, resources.MetricsEnabled)
+	assert.True(t, resources.NearMemoryLimit)
+	assert.Equal(t, updated.UnixMilli(), resources.UpdatedAt)
+	assert.Equal(t, int64(200), resources.CPU.Usage)
+	assert.Equal(t, int64(200), resources.CPU.Request)
+	assert.Equal(t, int64(1000), resources.CPU.Limit)
+	assert.InDelta(t, 100, *resources.CPU.RequestPercentage, 0.01)
+	assert.InDelta(t, 20, *resources.CPU.LimitPercentage, 0.01)
+	assert.InDelta(t, 95, *resources.Pods[0].Memory.LimitPercentage, 0.01)
+	assert.True(t, resources.Pods[0].Containers[0].NearMemoryLimit)
+	assert.False(t, resources.Pods[1].Containers[0].NearMemoryLimit)
+
+	// a pod without limits means the instance as a whole has none
+	resources = InstanceResources("block-1", []*corev1.Pod{resourcePod("todo-1", true), resourcePod("todo-2", false)}, usage, updated)
+	assert.Zero(t, resources.Memory.Limit)
+	assert.Nil(t, resources.Memory.LimitPercentage)
+	assert.True(t, resources.NearMemoryLimit)
+
+	// a pod that has no metrics yet isn't counted as using nothing
+	resources = InstanceResources("block-1", []*corev1.Pod{resourcePod("todo-1", true), resourcePod("todo-3", true)}, usage, updated)
+	assert.True(t, resources.Pods[0].Measured)
+	assert.False(t, resources.Pods[1].Measured)
+	assert.False(t, resources.Pods[1].Containers[0].Measured)
+	assert.Nil(t, resources.Pods[1].CPU.RequestPercentage)
+	assert.Nil(t, resources.Pods[1].Containers[0].Memory.LimitPercentage)
+	assert.Equal(t, int64(50), resources.CPU.Usage)
+	assert.Equal(t, int64(100), resources.CPU.Request)
+	assert.InDelta(t, 50, *resources.CPU.RequestPercentage, 0.01)
+
+	// without metrics-server only the requests and limits are known
+	resources = InstanceResources("block-1", []*corev1.Pod{resourcePod("todo-1", true)}, nil, time.Time{})
+	assert.False(t, resources.MetricsEnabled)
+	assert.False(t, resources.NearMemoryLimit)
+	assert.Zero(t, resources.UpdatedAt)
+	assert.Equal(t, int64(100*1024*1024), resources.Memory.Request)
+	assert.Nil(t, resources.Memory.RequestPercentage)
+	assert.False(t, resources.Pods[0].Measured)
+}
+
+func TestMetricsViewRefresh(t *testing.T) {
+	metrics := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "metrics.k8s.io/v1beta1",
+		"kind":       "PodMetrics",
+		"metadata":   map[string]interface{}{"name": "todo-1", "namespace": "services"},
+		"timestamp":  "2024-05-01T10:00:00Z",
+		"window":     "15s",
+		"containers": []interface{}{
+			map[string]interface{}{"name": "main", "usage": map[string]interface{}{"cpu": "12345678n", "memory": "2048Ki"}},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		PodMetricsResource: "PodMetricsList",
+	})
+	// created through the client, the fake would guess podmetricses as the resource of the kind
+	_, err := client.Resource(PodMetricsResource).Namespace("services").Create(context.Background(), metrics, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	view := NewMetricsView(client, time.Minute)
+	usage, _ := view.Usage()
+	assert.Nil(t, usage)
+
+	view.refresh(context.Background())
+	usage, updated := view.Usage()
+	container := usage["todo-1/main"]
+	assert.Equal(t, int64(13), container.Cpu().MilliValue())
+	assert.Equal(t, int64(2*1024*1024), container.Memory().Value())
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), updated.UTC())
+}
@@ -0,0 +1,71 @@
+package status
+
+import (
+	"fmt"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PodsForSelector returns the pods matched by a workload selector
+func PodsForSelector(selector *metav1.LabelSelector, pods []*corev1.Pod) []*corev1.Pod {
+	result := []*corev1.Pod{}
+	if selector == nil {
+		return result
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil || s.Empty() {
+		return result
+	}
+	for _, pod := range pods {
+		if s.Matches(labels.Set(pod.Labels)) {
+			result = append(result, pod)
+		}
+	}
+	return result
+}
+
+// podProblem looks for containers that are stuck, it returns the state, reason and
+// message of the first problem found or an empty state if the pods look fine
+func podProblem(pods []*corev1.Pod) (string, string, string) {
+	for _, pod := range pods {
+		statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if cs.State.Waiting == nil {
+				continue
+			}
+			switch cs.State.Waiting.Reason {
+			case "CrashLoopBackOff":
+				message := cs.State.Waiting.Message
+				if t := cs.LastTerminationState.Terminated; t != nil {
+					message = fmt.Sprintf("container %v in pod %v keeps exiting, last exit code %d (%v)", cs.Name, pod.Name, t.ExitCode, t.Reason)
+				}
+				return model.StateCrashLooping, cs.State.Waiting.Reason, message
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull":
+				return model.StateImagePullError, cs.State.Waiting.Reason, fmt.Sprintf("pod %v: %v", pod.Name, cs.State.Waiting.Message)
+			case "CreateContainerConfigError", "CreateContainerError", "RunContainerError":
+				return model.StateFailed, cs.State.Waiting.Reason, fmt.Sprintf("pod %v: %v", pod.Name, cs.State.Waiting.Message)
+			}
+		}
+	}
+	return "", "", ""
+}
+
+// pendingReason returns why the pods are pending, e.g. because they can't be scheduled
+func pendingReason(pods []*corev1.Pod) (string, string, bool) {
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodPending {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+				return condition.Reason, condition.Message, true
+			}
+		}
+		return "PodPending", fmt.Sprintf("pod %v is pending", pod.Name), true
+	}
+	return "", "", false
+}
@@ -0,0 +1,93 @@
+package status
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodStates returns the detailed state of each pod, probe failures are taken
+// from the "Unhealthy" events of the pods
+func PodStates(pods []*corev1.Pod, events []corev1.Event) []model.PodState {
+	probeFailures := map[string][]corev1.Event{}
+	for _, event := range events {
+		if event.InvolvedObject.Kind == "Pod" && event.Reason == "Unhealthy" {
+			probeFailures[event.InvolvedObject.Name] = append(probeFailures[event.InvolvedObject.Name], event)
+		}
+	}
+
+	result := []model.PodState{}
+	for _, pod := range pods {
+		state := model.PodState{
+			Name:       pod.Name,
+			Phase:      string(pod.Status.Phase),
+			Node:       pod.Spec.NodeName,
+			Containers: []model.ContainerState{},
+		}
+		if pod.Status.StartTime != nil {
+			state.StartTime = pod.Status.StartTime.UnixMilli()
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady {
+				state.Ready = condition.Status == corev1.ConditionTrue
+			}
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			state.RestartCount += cs.RestartCount
+			state.Containers = append(state.Containers, containerState(cs))
+		}
+
+		failures := probeFailures[pod.Name]
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].LastTimestamp.After(failures[j].LastTimestamp.Time)
+		})
+		for _, event := range failures {
+			state.ProbeFailures = append(state.ProbeFailures, event.Message)
+		}
+		result = append(result, state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func containerState(cs corev1.ContainerStatus) model.ContainerState {
+	state := model.ContainerState{
+		Name:         cs.Name,
+		Image:        cs.Image,
+		ImageDigest:  imageDigest(cs.ImageID),
+		Ready:        cs.Ready,
+		RestartCount: cs.RestartCount,
+	}
+	switch {
+	case cs.State.Running != nil:
+		state.State = "Running"
+	case cs.State.Waiting != nil:
+		state.State = "Waiting"
+		state.Reason = cs.State.Waiting.Reason
+		state.Message = cs.State.Waiting.Message
+	case cs.State.Terminated != nil:
+		state.State = "Terminated"
+		state.Reason = cs.State.Terminated.Reason
+		state.Message = cs.State.Terminated.Message
+	default:
+		state.State = "Unknown"
+	}
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		exitCode := t.ExitCode
+		state.LastTerminationReason = t.Reason
+		state.LastExitCode = &exitCode
+	}
+	return state
+}
+
+// imageDigest extracts the digest from an image id like docker-pullable://repo@sha256:abc
+func imageDigest(imageID string) string {
+	if _, digest, found := strings.Cut(imageID, "@"); found {
+		return digest
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodStates(t *testing.T) {
+	pods := []*corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-block-abc"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}},
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "main",
+				Image:                "europe-docker.pkg.dev/kapeta/block:1.0.0",
+				ImageID:              "docker-pullable://europe-docker.pkg.dev/kapeta/block@sha256:abc",
+				RestartCount:         3,
+				State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}},
+			}},
+		},
+	}}
+	now := time.Now()
+	events := []corev1.Event{
+		{InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "my-block-abc"}, Reason: "Unhealthy", Message: "older", LastTimestamp: metav1.NewTime(now.Add(-time.Minute))},
+		{InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "my-block-abc"}, Reason: "Unhealthy", Message: "Readiness probe failed: 503", LastTimestamp: metav1.NewTime(now)},
+		{InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other"}, Reason: "Unhealthy", Message: "other pod"},
+	}
+
+	states := PodStates(pods, events)
+	assert.Len(t, states, 1)
+	state := states[0]
+	assert.Equal(t, "Running", state.Phase)
+	assert.False(t, state.Ready)
+	assert.Equal(t, "node-1", state.Node)
+	assert.Equal(t, int32(3), state.RestartCount)
+	assert.Equal(t, []string{"Readiness probe failed: 503", "older"}, state.ProbeFailures)
+
+	container := state.Containers[0]
+	assert.Equal(t, "sha256:abc", container.ImageDigest)
+	assert.Equal(t, "Running", container.State)
+	assert.Equal(t, "OOMKilled", container.LastTerminationReason)
+	assert.Equal(t, int32(137), *container.LastExitCode)
+}
@@ -0,0 +1,69 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusClient runs instant queries against the Prometheus HTTP API
+type PrometheusClient struct {
+	url    string
+	client *http.Client
+}
+
+func NewPrometheusClient(prometheusURL string) *PrometheusClient {
+	return &PrometheusClient{url: strings.TrimSuffix(prometheusURL, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// the response of /api/v1/query for a vector result
+type queryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// Query runs the query and returns the value of every series by the value of the label, series
+// without a value, like a quantile of a histogram without observations, are left out
+func (p *PrometheusClient) Query(ctx context.Context, query string, label string) (map[string]float64, error) {
+	data, err := httpGet(ctx, p.client, p.url+"/api/v1/query?query="+url.QueryEscape(query))
+	if err != nil {
+		return nil, err
+	}
+	response := queryResponse{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error decoding prometheus response: %v", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %v: %v", response.ErrorType, response.Error)
+	}
+	if response.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("unexpected prometheus result type %v", response.Data.ResultType)
+	}
+	result := map[string]float64{}
+	for _, series := range response.Data.Result {
+		s, ok := series.Value[1].(string)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		result[series.Metric[label]] = value
+	}
+	return result, nil
+}
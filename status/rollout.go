@@ -0,0 +1,184 @@
+package status
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	// versionAnnotation on the pod template is the environment version the deployment was written for
+	versionAnnotation = "kapeta.com/environment-version"
+)
+
+// Rollout returns the progress of the block deployments towards the environment version of the secret. While a
+// rollout is in progress the elapsed time is counted until now, once complete it is the time the rollout took.
+// A block changed by the version, nil meaning all blocks, is only updated once it has a ReplicaSet newer than the secret.
+func Rollout(secret *corev1.Secret, changed map[string]bool, deployments []*appsv1.Deployment, replicaSets []*appsv1.ReplicaSet, now time.Time) model.RolloutProgress {
+	progress := model.RolloutProgress{
+		EnvironmentName:    secret.Labels["kapeta.com/environment-name"],
+		EnvironmentVersion: secret.Labels["kapeta.com/environment-version"],
+		StartedAt:          secret.CreationTimestamp.UnixMilli(),
+		Complete:           true,
+		Blocks:             []model.BlockRollout{},
+	}
+	finished := secret.CreationTimestamp.Time
+	for _, deployment := range deployments {
+		rs := newestReplicaSet(deployment, replicaSets)
+		blockID := deployment.Labels["kapeta.com/block-id"]
+		waiting := !updatedFor(secret, deployment, rs, changed == nil || changed[blockID])
+		block, completedAt := blockRollout(deployment, rs, waiting, now)
+		if waiting {
+			// the rollout of the block hasn't started yet, it has been waiting since the version was stored
+			block.StartedAt = secret.CreationTimestamp.UnixMilli()
+			block.ElapsedSeconds = int64(now.Sub(secret.CreationTimestamp.Time).Seconds())
+		}
+		progress.Blocks = append(progress.Blocks, block)
+		progress.Stalled = progress.Stalled || block.Stalled
+		progress.Complete = progress.Complete && block.Complete
+		if completedAt.After(finished) {
+			finished = completedAt
+		}
+	}
+	if progress.Complete {
+		progress.ElapsedSeconds = int64(finished.Sub(secret.CreationTimestamp.Time).Seconds())
+	} else {
+		progress.ElapsedSeconds = int64(now.Sub(secret.CreationTimestamp.Time).Seconds())
+	}
+	return progress
+}
+
+// updatedFor tells if the deployment has been updated to the version of the secret, its pod template has to
+// carry the version if it is annotated with one and a changed block needs a ReplicaSet created after the secret
+func updatedFor(secret *corev1.Secret, deployment *appsv1.Deployment, rs *appsv1.ReplicaSet, changed bool) bool {
+	if version, ok := deployment.Spec.Template.Annotations[versionAnnotation]; ok {
+		return version == secret.Labels["kapeta.com/environment-version"]
+	}
+	return !changed || (rs != nil && !rs.CreationTimestamp.Before(&secret.CreationTimestamp))
+}
+
+// changedBlocks returns the ids of the blocks added or changed by a version, or nil if the environment
+// configuration changed as that is passed to every block
+func changedBlocks(diff model.VersionDiff) map[string]bool {
+	if len(diff.Configuration) > 0 {
+		return nil
+	}
+	changed := map[string]bool{}
+	for _, change := range append(diff.Added, diff.Changed...) {
+		changed[change.ID] = true
+	}
+	return changed
+}
+
+// blockRollout returns the progress of a deployment and the time its rollout completed, waiting
+// is true while the deployment hasn't been updated to the new version yet
+func blockRollout(deployment *appsv1.Deployment, rs *appsv1.ReplicaSet, waiting bool, now time.Time) (model.BlockRollout, time.Time) {
+	status := deployment.Status
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	block := model.BlockRollout{
+		Name:      deployment.Name,
+		BlockID:   deployment.Labels["kapeta.com/block-id"],
+		Revision:  deployment.Annotations[revisionAnnotation],
+		Desired:   desired,
+		Updated:   status.UpdatedReplicas,
+		Ready:     status.ReadyReplicas,
+		Available: status.AvailableReplicas,
+	}
+	started := deployment.CreationTimestamp.Time
+	if rs != nil {
+		block.ReplicaSet = rs.Name
+		// the counts of the new ReplicaSet, the deployment counts include the old pods
+		block.Ready = rs.Status.ReadyReplicas
+		block.Available = rs.Status.AvailableReplicas
+		started = rs.CreationTimestamp.Time
+	}
+	block.StartedAt = started.UnixMilli()
+
+	progressing := deploymentCondition(deployment, appsv1.DeploymentProgressing)
+	switch {
+	case waiting:
+		block.Reason, block.Message = "WaitingForUpdate", "the deployment has not been updated to the new version yet"
+	case progressing != nil && progressing.Status == corev1.ConditionFalse && progressing.Reason == "ProgressDeadlineExceeded":
+		block.Stalled = true
+		block.Reason, block.Message = progressing.Reason, progressing.Message
+	case status.ObservedGeneration < deployment.Generation:
+		block.Reason, block.Message = "NewGeneration", "waiting for the new generation to be observed"
+	case status.UpdatedReplicas < desired:
+		block.Reason, block.Message = "RollingUpdate", fmt.Sprintf("%d of %d replicas have been updated", status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		block.Reason, block.Message = "RollingUpdate", fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)
+	case block.Available < desired:
+		block.Reason, block.Message = "WaitingForAvailability", fmt.Sprintf("%d of %d updated replicas are available", block.Available, desired)
+	default:
+		block.Complete = true
+	}
+
+	if !block.Complete {
+		block.ElapsedSeconds = int64(now.Sub(started).Seconds())
+		return block, time.Time{}
+	}
+	// the deployment controller updates the condition when the new ReplicaSet became available
+	completedAt := started
+	if progressing != nil && progressing.Reason == "NewReplicaSetAvailable" && progressing.LastUpdateTime.After(started) {
+		completedAt = progressing.LastUpdateTime.Time
+	}
+	block.ElapsedSeconds = int64(completedAt.Sub(started).Seconds())
+	return block, completedAt
+}
+
+// newestReplicaSet returns the ReplicaSet of the current revision of the deployment, or the one
+// with the highest revision if the deployment hasn't been annotated yet
+func newestReplicaSet(deployment *appsv1.Deployment, replicaSets []*appsv1.ReplicaSet) *appsv1.ReplicaSet {
+	var newest *appsv1.ReplicaSet
+	newestRevision := -1
+	for _, rs := range replicaSets {
+		if !ownedBy(rs, deployment) {
+			continue
+		}
+		if revision := deployment.Annotations[revisionAnnotation]; revision != "" && rs.Annotations[revisionAnnotation] == revision {
+			return rs
+		}
+		if revision, err := strconv.Atoi(rs.Annotations[revisionAnnotation]); err == nil && revision > newestRevision {
+			newest, newestRevision = rs, revision
+		}
+	}
+	return newest
+}
+
+func ownedBy(rs *appsv1.ReplicaSet, deployment *appsv1.Deployment) bool {
+	for _, owner := range rs.OwnerReferences {
+		if owner.Kind == "Deployment" && owner.Name == deployment.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// RolloutChanged tells if the progress differs from the previous one, ignoring the elapsed time
+func RolloutChanged(prev *model.RolloutProgress, next *model.RolloutProgress) bool {
+	if prev == nil || next == nil {
+		return prev != next
+	}
+	a, b := *prev, *next
+	a.ElapsedSeconds, b.ElapsedSeconds = 0, 0
+	a.Blocks, b.Blocks = withoutElapsed(a.Blocks), withoutElapsed(b.Blocks)
+	return !reflect.DeepEqual(a, b)
+}
+
+func withoutElapsed(blocks []model.BlockRollout) []model.BlockRollout {
+	result := make([]model.BlockRollout, 0, len(blocks))
+	for _, block := range blocks {
+		block.ElapsedSeconds = 0
+		result = append(result, block)
+	}
+	return result
+}
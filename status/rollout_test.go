@@ -0,0 +1,158 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func rolloutDeployment(revision string, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	replicas := int32(2)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "todo",
+			Namespace:   "services",
+			Generation:  2,
+			Labels:      map[string]string{"kapeta.com/block-id": "block-1"},
+			Annotations: map[string]string{revisionAnnotation: revision},
+		},
+		Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: status,
+	}
+}
+
+func replicaSet(name string, revision string, created time.Time, ready int32) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "services",
+			CreationTimestamp: metav1.NewTime(created),
+			Annotations:       map[string]string{revisionAnnotation: revision},
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "Deployment", Name: "todo"}},
+		},
+		Status: appsv1.ReplicaSetStatus{ReadyReplicas: ready, AvailableReplicas: ready},
+	}
+}
+
+func TestRollout(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	secret := versionSecret("kapeta-2", "2", now.Add(-5*time.Minute), "{}")
+	replicaSets := []*appsv1.ReplicaSet{
+		replicaSet("todo-old", "1", now.Add(-time.Hour), 1),
+		replicaSet("todo-new", "2", now.Add(-4*time.Minute), 1),
+	}
+
+	tests := []struct {
+		name     string
+		status   appsv1.DeploymentStatus
+		complete bool
+		stalled  bool
+		reason   string
+		elapsed  int64
+	}{
+		{
+			name:    "rolling update",
+			status:  appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 2, AvailableReplicas: 2},
+			reason:  "RollingUpdate",
+			elapsed: 240,
+		},
+		{
+			name:    "stalled",
+			status:  appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"}}},
+			stalled: true,
+			reason:  "ProgressDeadlineExceeded",
+			elapsed: 240,
+		},
+		{
+			name: "complete",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2, Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "NewReplicaSetAvailable", LastUpdateTime: metav1.NewTime(now.Add(-time.Minute))},
+			}},
+			complete: true,
+			elapsed:  180,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := replicaSets
+			if tt.complete {
+				rs = []*appsv1.ReplicaSet{replicaSets[0], replicaSet("todo-new", "2", now.Add(-4*time.Minute), 2)}
+			}
+			progress := Rollout(secret, nil, []*appsv1.Deployment{rolloutDeployment("2", tt.status)}, rs, now)
+			assert.Equal(t, "2", progress.EnvironmentVersion)
+			assert.Equal(t, tt.complete, progress.Complete)
+			assert.Equal(t, tt.stalled, progress.Stalled)
+			assert.Len(t, progress.Blocks, 1)
+
+			block := progress.Blocks[0]
+			assert.Equal(t, "todo-new", block.ReplicaSet)
+			assert.Equal(t, tt.status.UpdatedReplicas, block.Updated)
+			assert.Equal(t, tt.reason, block.Reason)
+			assert.Equal(t, tt.elapsed, block.ElapsedSeconds)
+			assert.Equal(t, now.Add(-4*time.Minute).UnixMilli(), block.StartedAt)
+		})
+	}
+}
+
+func TestRolloutWaitingForUpdate(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	secret := versionSecret("kapeta-2", "2", now.Add(-time.Minute), "{}")
+	// the operator hasn't touched the deployment yet, it still looks like a finished rollout
+	deployment := rolloutDeployment("1", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2})
+	replicaSets := []*appsv1.ReplicaSet{replicaSet("todo-old", "1", now.Add(-time.Hour), 2)}
+
+	progress := Rollout(secret, map[string]bool{"block-1": true}, []*appsv1.Deployment{deployment}, replicaSets, now)
+	assert.False(t, progress.Complete)
+	assert.Equal(t, "WaitingForUpdate", progress.Blocks[0].Reason)
+	assert.Equal(t, secret.CreationTimestamp.UnixMilli(), progress.Blocks[0].StartedAt)
+	assert.Equal(t, int64(60), progress.Blocks[0].ElapsedSeconds)
+
+	// blocks the version didn't change are done
+	progress = Rollout(secret, map[string]bool{"block-2": true}, []*appsv1.Deployment{deployment}, replicaSets, now)
+	assert.True(t, progress.Complete)
+
+	// the version on the pod template is used when it is there
+	deployment.Spec.Template.Annotations = map[string]string{versionAnnotation: "1"}
+	progress = Rollout(secret, map[string]bool{}, []*appsv1.Deployment{deployment}, replicaSets, now)
+	assert.Equal(t, "WaitingForUpdate", progress.Blocks[0].Reason)
+	deployment.Spec.Template.Annotations[versionAnnotation] = "2"
+	progress = Rollout(secret, map[string]bool{"block-1": true}, []*appsv1.Deployment{deployment}, replicaSets, now)
+	assert.True(t, progress.Complete)
+}
+
+func TestChangedBlocks(t *testing.T) {
+	diff := model.VersionDiff{Added: []model.ServiceChange{{ID: "block-1"}}, Changed: []model.ServiceChange{{ID: "block-2"}}, Removed: []model.ServiceChange{{ID: "block-3"}}}
+	assert.Equal(t, map[string]bool{"block-1": true, "block-2": true}, changedBlocks(diff))
+	diff.Configuration = []string{"region"}
+	assert.Nil(t, changedBlocks(diff))
+}
+
+func TestRolloutChanged(t *testing.T) {
+	prev := &model.RolloutProgress{ElapsedSeconds: 10, Blocks: []model.BlockRollout{{Name: "todo", Updated: 1, ElapsedSeconds: 10}}}
+	next := &model.RolloutProgress{ElapsedSeconds: 20, Blocks: []model.BlockRollout{{Name: "todo", Updated: 1, ElapsedSeconds: 20}}}
+	assert.False(t, RolloutChanged(prev, next))
+	next.Blocks[0].Updated = 2
+	assert.True(t, RolloutChanged(prev, next))
+}
+
+func TestCacheRollout(t *testing.T) {
+	now := time.Now()
+	c := startTestCache(t, []runtime.Object{
+		versionSecret("kapeta-1", "1", now.Add(-time.Hour), "{}"),
+		versionSecret("kapeta-2", "2", now, "{}"),
+		rolloutDeployment("2", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1}),
+		replicaSet("todo-new", "2", now, 0),
+	}, nil)
+
+	progress, err := c.Rollout()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", progress.EnvironmentVersion)
+	assert.False(t, progress.Complete)
+	assert.Equal(t, "todo-new", progress.Blocks[0].ReplicaSet)
+}
@@ -0,0 +1,259 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+)
+
+// The Istio standard metrics are used, the blocks are the workloads receiving the requests
+// and the gateway routes are the services called by the ingress gateway
+const (
+	workloadTraffic = `reporter="destination",destination_workload_namespace="services"`
+	workloadLabel   = "destination_workload"
+	ingressTraffic  = `reporter="source",source_workload=~"istio-ingressgateway.*",destination_service_namespace="services"`
+	serviceLabel    = "destination_service_name"
+)
+
+// The traffic health of an instance, the exact signals are served by /status/signals
+const (
+	TrafficIdle    = "idle"
+	TrafficHealthy = "healthy"
+	TrafficSlow    = "slow"
+	TrafficFailing = "failing"
+)
+
+var (
+	// traffic with a larger share of 5xx responses is failing
+	trafficErrorThreshold = 0.05
+	// traffic with a slower p95 latency in milliseconds is slow
+	trafficLatencyThreshold = 1000.0
+)
+
+// GoldenSignals queries the request rate, error rate and latency quantiles over the window of the
+// traffic matching the selector, grouped by the label
+func (p *PrometheusClient) GoldenSignals(ctx context.Context, selector string, label string, window time.Duration) (map[string]model.GoldenSignals, error) {
+	rangeSelector := fmt.Sprintf("[%ds]", int64(window.Seconds()))
+	requests, err := p.Query(ctx, fmt.Sprintf(`sum by (%s) (rate(istio_requests_total{%s}%s))`, label, selector, rangeSelector), label)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := p.Query(ctx, fmt.Sprintf(`sum by (%s) (rate(istio_requests_total{%s,response_code=~"5.."}%s))`, label, selector, rangeSelector), label)
+	if err != nil {
+		return nil, err
+	}
+	quantiles := map[float64]map[string]float64{}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		quantiles[q], err = p.Query(ctx, fmt.Sprintf(`histogram_quantile(%v, sum by (%s, le) (rate(istio_request_duration_milliseconds_bucket{%s}%s)))`, q, label, selector, rangeSelector), label)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := map[string]model.GoldenSignals{}
+	for name, rate := range requests {
+		if name == "" {
+			continue
+		}
+		signals := model.GoldenSignals{
+			RequestRate: rate,
+			LatencyP50:  lookup(quantiles[0.5], name),
+			LatencyP95:  lookup(quantiles[0.95], name),
+			LatencyP99:  lookup(quantiles[0.99], name),
+		}
+		if rate > 0 {
+			signals.ErrorRate = failures[name] / rate
+		}
+		result[name] = signals
+	}
+	return result, nil
+}
+
+// Signals returns the golden signals of the workloads and of the services behind the ingress gateway
+func (p *PrometheusClient) Signals(ctx context.Context, window time.Duration) (map[string]model.GoldenSignals, map[string]model.GoldenSignals, error) {
+	workloads, err := p.GoldenSignals(ctx, workloadTraffic, workloadLabel, window)
+	if err != nil {
+		return nil, nil, err
+	}
+	services, err := p.GoldenSignals(ctx, ingressTraffic, serviceLabel, window)
+	if err != nil {
+		return nil, nil, err
+	}
+	return workloads, services, nil
+}
+
+// SignalsView keeps the golden signals of the last window, refreshed every interval, so the status
+// can show traffic health without querying Prometheus on every request
+type SignalsView struct {
+	prometheus *PrometheusClient
+	window     time.Duration
+	interval   time.Duration
+
+	mu        sync.RWMutex
+	workloads map[string]model.GoldenSignals
+	services  map[string]model.GoldenSignals
+	updated   time.Time
+}
+
+func NewSignalsView(prometheus *PrometheusClient, window time.Duration, interval time.Duration) *SignalsView {
+	return &SignalsView{prometheus: prometheus, window: window, interval: interval}
+}
+
+// Start refreshes the signals every interval until the context is cancelled
+func (v *SignalsView) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+		for {
+			v.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (v *SignalsView) refresh(ctx context.Context) {
+	workloads, services, err := v.prometheus.Signals(ctx, v.window)
+	if err != nil {
+		log.Printf("error getting golden signals from prometheus: %v\n", err)
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.workloads, v.services = workloads, services
+	v.updated = time.Now()
+}
+
+// Signals returns the signals of the workloads and the services of the last refresh
+func (v *SignalsView) Signals() (map[string]model.GoldenSignals, map[string]model.GoldenSignals) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.workloads, v.services
+}
+
+// Updated returns the time of the last successful refresh
+func (v *SignalsView) Updated() time.Time {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.updated
+}
+
+// BuildSignalsReport keys the signals of the workloads by the block ids of the instances, a gateway
+// route gets the combined signals of the services it routes to and is keyed like the status stream,
+// as routes of different providers can share a name
+func BuildSignalsReport(window string, instances []model.InstanceState, workloads map[string]model.GoldenSignals, services map[string]model.GoldenSignals) model.SignalsReport {
+	report := model.SignalsReport{
+		Window:   window,
+		Blocks:   map[string]model.GoldenSignals{},
+		Gateways: map[string]model.GoldenSignals{},
+	}
+	for _, instance := range instances {
+		if signals, ok := instanceSignals(instance, workloads, services); ok {
+			if instance.Type == model.TypeGateway {
+				report.Gateways[InstanceKey(instance)] = signals
+			} else if instance.BlockID != "" {
+				report.Blocks[instance.BlockID] = signals
+			}
+		}
+	}
+	return report
+}
+
+// addSignals adds the traffic health of the instances to their metadata, the signals themselves
+// change with every refresh so they would make every refresh a change of the status
+func addSignals(instances []model.InstanceState, workloads map[string]model.GoldenSignals, services map[string]model.GoldenSignals) {
+	for i := range instances {
+		signals, ok := instanceSignals(instances[i], workloads, services)
+		if !ok {
+			continue
+		}
+		if instances[i].Metadata == nil {
+			instances[i].Metadata = map[string]string{}
+		}
+		instances[i].Metadata["kapeta.com/traffic_health"] = TrafficHealth(signals)
+	}
+}
+
+// TrafficHealth buckets the signals into a value that only changes when the traffic does
+func TrafficHealth(signals model.GoldenSignals) string {
+	switch {
+	case signals.RequestRate == 0:
+		return TrafficIdle
+	case signals.ErrorRate > trafficErrorThreshold:
+		return TrafficFailing
+	case signals.LatencyP95 != nil && *signals.LatencyP95 > trafficLatencyThreshold:
+		return TrafficSlow
+	}
+	return TrafficHealthy
+}
+
+func instanceSignals(instance model.InstanceState, workloads map[string]model.GoldenSignals, services map[string]model.GoldenSignals) (model.GoldenSignals, bool) {
+	switch instance.Type {
+	case model.TypeBlock, model.TypeStatefulSet, model.TypeDaemonSet:
+		signals, ok := workloads[instance.Name]
+		return signals, ok
+	case model.TypeGateway:
+		combined := []model.GoldenSignals{}
+		for _, destination := range strings.Split(instance.Metadata["kapeta.com/destinations"], ",") {
+			if signals, ok := services[destinationService(destination)]; ok {
+				combined = append(combined, signals)
+			}
+		}
+		if len(combined) == 0 {
+			return model.GoldenSignals{}, false
+		}
+		return combineSignals(combined), true
+	}
+	return model.GoldenSignals{}, false
+}
+
+// destinationService returns the service name of a destination given as a host or as namespace/name
+func destinationService(destination string) string {
+	if _, name, ok := strings.Cut(destination, "/"); ok {
+		return name
+	}
+	if _, name, ok := serviceForHost(destination, "services"); ok {
+		return name
+	}
+	return ""
+}
+
+// combineSignals adds up the rates, the latency of the slowest service is used as the
+// quantiles of separate histograms can't be combined
+func combineSignals(signals []model.GoldenSignals) model.GoldenSignals {
+	result := model.GoldenSignals{}
+	failures := 0.0
+	for _, s := range signals {
+		result.RequestRate += s.RequestRate
+		failures += s.ErrorRate * s.RequestRate
+		result.LatencyP50 = maxLatency(result.LatencyP50, s.LatencyP50)
+		result.LatencyP95 = maxLatency(result.LatencyP95, s.LatencyP95)
+		result.LatencyP99 = maxLatency(result.LatencyP99, s.LatencyP99)
+	}
+	if result.RequestRate > 0 {
+		result.ErrorRate = failures / result.RequestRate
+	}
+	return result
+}
+
+func maxLatency(a *float64, b *float64) *float64 {
+	if a == nil || (b != nil && *b > *a) {
+		return b
+	}
+	return a
+}
+
+func lookup(values map[string]float64, name string) *float64 {
+	if value, ok := values[name]; ok {
+		return &value
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// prometheusServer answers the golden signal queries with a vector per label value
+func prometheusServer(t *testing.T, values map[string]map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		assert.Contains(t, query, "[300s]")
+		kind := "requests"
+		switch {
+		case strings.Contains(query, "histogram_quantile(0.5,"):
+			kind = "p50"
+		case strings.Contains(query, "histogram_quantile(0.95,"):
+			kind = "p95"
+		case strings.Contains(query, "histogram_quantile(0.99,"):
+			kind = "p99"
+		case strings.Contains(query, `response_code=~"5.."`):
+			kind = "errors"
+		}
+		label := workloadLabel
+		if strings.Contains(query, "by ("+serviceLabel) {
+			label = serviceLabel
+		}
+		results := []string{}
+		for name, value := range values[label+"/"+kind] {
+			results = append(results, fmt.Sprintf(`{"metric": {%q: %q}, "value": [1714557600, %q]}`, label, name, value))
+		}
+		_, _ = fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [%s]}}`, strings.Join(results, ","))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPrometheusSignals(t *testing.T) {
+	server := prometheusServer(t, map[string]map[string]string{
+		workloadLabel + "/requests": {"todo": "10", "users": "0"},
+		workloadLabel + "/errors":   {"todo": "0.5"},
+		workloadLabel + "/p50":      {"todo": "12"},
+		workloadLabel + "/p95":      {"todo": "80", "users": "NaN"},
+		workloadLabel + "/p99":      {"todo": "250"},
+		serviceLabel + "/requests":  {"todo": "4", "users": "1"},
+		serviceLabel + "/errors":    {"users": "1"},
+		serviceLabel + "/p95":       {"todo": "90", "users": "40"},
+	})
+
+	workloads, services, err := NewPrometheusClient(server.URL+"/").Signals(context.Background(), 5*time.Minute)
+	assert.NoError(t, err)
+	assert.InDelta(t, 10, workloads["todo"].RequestRate, 0.001)
+	assert.InDelta(t, 0.05, workloads["todo"].ErrorRate, 0.001)
+	assert.InDelta(t, 12, *workloads["todo"].LatencyP50, 0.001)
+	assert.InDelta(t, 80, *workloads["todo"].LatencyP95, 0.001)
+	assert.InDelta(t, 250, *workloads["todo"].LatencyP99, 0.001)
+	assert.Zero(t, workloads["users"].ErrorRate)
+	assert.Nil(t, workloads["users"].LatencyP95)
+
+	instances := []model.InstanceState{
+		{Type: model.TypeBlock, Name: "todo", BlockID: "block-1"},
+		{Type: model.TypeBlock, Name: "orders", BlockID: "block-3"},
+		{Type: model.TypeGateway, Name: "todo-gateway", Metadata: map[string]string{"kapeta.com/provider": "istio", "kapeta.com/destinations": "todo,users.services.svc.cluster.local"}},
+		{Type: model.TypeGateway, Name: "todo-gateway", Metadata: map[string]string{"kapeta.com/provider": "ingress", "kapeta.com/destinations": "todo"}},
+	}
+	report := BuildSignalsReport("5m", instances, workloads, services)
+	assert.Equal(t, "5m", report.Window)
+	assert.Len(t, report.Blocks, 1)
+	assert.InDelta(t, 10, report.Blocks["block-1"].RequestRate, 0.001)
+
+	assert.Len(t, report.Gateways, 2)
+	assert.InDelta(t, services["todo"].RequestRate, report.Gateways["gateway/ingress/todo-gateway"].RequestRate, 0.001)
+	gateway := report.Gateways["gateway/istio/todo-gateway"]
+	assert.InDelta(t, 5, gateway.RequestRate, 0.001)
+	assert.InDelta(t, 0.2, gateway.ErrorRate, 0.001)
+	assert.InDelta(t, 90, *gateway.LatencyP95, 0.001)
+	assert.Nil(t, gateway.LatencyP50)
+
+	addSignals(instances, workloads, services)
+	assert.Equal(t, TrafficHealthy, instances[0].Metadata["kapeta.com/traffic_health"])
+	assert.NotContains(t, instances[1].Metadata, "kapeta.com/traffic_health")
+	assert.Equal(t, TrafficFailing, instances[2].Metadata["kapeta.com/traffic_health"])
+}
+
+func TestTrafficHealth(t *testing.T) {
+	slow := 1500.0
+	fast := 50.0
+	assert.Equal(t, TrafficIdle, TrafficHealth(model.GoldenSignals{}))
+	assert.Equal(t, TrafficHealthy, TrafficHealth(model.GoldenSignals{RequestRate: 3, ErrorRate: 0.01, LatencyP95: &fast}))
+	assert.Equal(t, TrafficSlow, TrafficHealth(model.GoldenSignals{RequestRate: 3, LatencyP95: &slow}))
+	assert.Equal(t, TrafficFailing, TrafficHealth(model.GoldenSignals{RequestRate: 3, ErrorRate: 0.5, LatencyP95: &slow}))
+}
+
+func TestPrometheusQueryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "error", "errorType": "bad_data", "error": "parse error"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewPrometheusClient(server.URL).Query(context.Background(), "up", "job")
+	assert.ErrorContains(t, err, "parse error")
+}
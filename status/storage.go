@@ -0,0 +1,249 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/kapetacom/insight-api/operators/local"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8s "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+var (
+	volumeStatsInterval = time.Minute
+	// volumes using more than this share of their capacity are flagged
+	volumeUsageThreshold = 0.85
+	// claims pending for longer than this are flagged as stuck
+	volumePendingTimeout = 5 * time.Minute
+	// the usage is reported in steps of this many percent
+	volumeUsageStep = 5.0
+)
+
+// VolumeUsage is the usage of a volume reported by the kubelet
+type VolumeUsage struct {
+	UsedBytes     int64
+	CapacityBytes int64
+}
+
+// the part of the kubelet stats summary we use
+type statsSummary struct {
+	Pods []struct {
+		Volumes []struct {
+			UsedBytes     *int64 `json:"usedBytes"`
+			CapacityBytes *int64 `json:"capacityBytes"`
+			PVCRef        *struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"pvcRef"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// volumeStats reads the usage of the volumes of the infrastructure pods from the stats summary of
+// the kubelets through the node proxy of the API server, only nodes running those pods are queried.
+// It is only enabled with VOLUME_STATS_ENABLED=true as it needs get on the nodes/proxy resource.
+type volumeStats struct {
+	fetch   func(ctx context.Context, node string) ([]byte, error)
+	pods    corelisters.PodLister
+	changed func()
+
+	mu      sync.RWMutex
+	usage   map[string]VolumeUsage
+	updated time.Time
+}
+
+func newVolumeStats(clientset k8s.Interface, pods corelisters.PodLister, changed func()) *volumeStats {
+	fetch := func(ctx context.Context, node string) ([]byte, error) {
+		return clientset.CoreV1().RESTClient().Get().AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").DoRaw(ctx)
+	}
+	return &volumeStats{fetch: fetch, pods: pods, changed: changed, usage: map[string]VolumeUsage{}}
+}
+
+// start reads the stats every interval until the context is cancelled, waiting for synced to be true first
+func (v *volumeStats) start(ctx context.Context, interval time.Duration, synced func() bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if synced() {
+				v.refresh(ctx)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (v *volumeStats) refresh(ctx context.Context) {
+	pods, err := v.pods.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	nodes := map[string]bool{}
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && pod.Spec.NodeName != "" {
+				nodes[pod.Spec.NodeName] = true
+			}
+		}
+	}
+
+	usage := map[string]VolumeUsage{}
+	for node := range nodes {
+		nodeUsage, err := v.nodeUsage(ctx, node)
+		if err != nil {
+			log.Printf("error getting volume stats of node %v: %v\n", node, err)
+			continue
+		}
+		for key, u := range nodeUsage {
+			usage[key] = u
+		}
+	}
+
+	v.mu.Lock()
+	changed := len(usage) != len(v.usage)
+	for key, u := range usage {
+		if usageBucket(u) != usageBucket(v.usage[key]) || aboveThreshold(u) != aboveThreshold(v.usage[key]) {
+			changed = true
+		}
+	}
+	v.usage = usage
+	v.updated = time.Now()
+	v.mu.Unlock()
+	if changed && v.changed != nil {
+		v.changed()
+	}
+}
+
+func (v *volumeStats) nodeUsage(ctx context.Context, node string) (map[string]VolumeUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	data, err := v.fetch(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	summary := statsSummary{}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("error decoding stats summary: %v", err)
+	}
+	usage := map[string]VolumeUsage{}
+	for _, pod := range summary.Pods {
+		for _, volume := range pod.Volumes {
+			if volume.PVCRef == nil || volume.UsedBytes == nil || volume.CapacityBytes == nil {
+				continue
+			}
+			usage[volume.PVCRef.Namespace+"/"+volume.PVCRef.Name] = VolumeUsage{UsedBytes: *volume.UsedBytes, CapacityBytes: *volume.CapacityBytes}
+		}
+	}
+	return usage, nil
+}
+
+// lastUsage returns the volume usage by namespace/claim of the last refresh
+func (v *volumeStats) lastUsage() map[string]VolumeUsage {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.usage
+}
+
+// lastUpdated returns the time of the last refresh
+func (v *volumeStats) lastUpdated() time.Time {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.updated
+}
+
+// VolumeState returns the state of the claim, usage is left out when the kubelet didn't report the volume
+// and is rounded otherwise, the exact usage changes all the time and would make the operator change too
+func VolumeState(pvc *corev1.PersistentVolumeClaim, usage map[string]VolumeUsage, now time.Time) model.VolumeState {
+	state := model.VolumeState{
+		Name:  pvc.Name,
+		Phase: string(pvc.Status.Phase),
+	}
+	if pvc.Spec.StorageClassName != nil {
+		state.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+		state.CapacityBytes = capacity.Value()
+	} else if request, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		state.CapacityBytes = request.Value()
+	}
+	if u, ok := usage[pvc.Namespace+"/"+pvc.Name]; ok && u.CapacityBytes > 0 {
+		percentage := usageBucket(u)
+		state.UsagePercentage = &percentage
+		if aboveThreshold(u) {
+			state.Reason, state.Message = "VolumeAlmostFull", fmt.Sprintf("volume %v is over %.0f%% full", pvc.Name, percentage)
+		}
+	}
+
+	switch pvc.Status.Phase {
+	case corev1.ClaimPending:
+		if pending := now.Sub(pvc.CreationTimestamp.Time); pending > volumePendingTimeout {
+			state.Reason, state.Message = "VolumePending", fmt.Sprintf("volume %v has been pending for %v", pvc.Name, pending.Round(time.Minute))
+		}
+	case corev1.ClaimLost:
+		state.Reason, state.Message = "VolumeLost", fmt.Sprintf("the persistent volume of %v was lost", pvc.Name)
+	}
+	return state
+}
+
+// addVolumes adds the claims mounted by the infrastructure deployment of every operator, a ready
+// operator with a volume warning is degraded
+func addVolumes(operators []model.OperatorState, infrastructure []*appsv1.Deployment, claims []*corev1.PersistentVolumeClaim, usage map[string]VolumeUsage, now time.Time) {
+	byName := map[string]*corev1.PersistentVolumeClaim{}
+	for _, pvc := range claims {
+		byName[pvc.Namespace+"/"+pvc.Name] = pvc
+	}
+	for i := range operators {
+		deployment := local.FindByBlockID(infrastructure, operators[i].ID)
+		if deployment == nil {
+			continue
+		}
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			claimName := volume.PersistentVolumeClaim.ClaimName
+			pvc := byName[deployment.Namespace+"/"+claimName]
+			if pvc == nil {
+				operators[i].Volumes = append(operators[i].Volumes, model.VolumeState{
+					Name:    claimName,
+					Reason:  "ClaimNotFound",
+					Message: fmt.Sprintf("persistent volume claim %v does not exist", claimName),
+				})
+				continue
+			}
+			operators[i].Volumes = append(operators[i].Volumes, VolumeState(pvc, usage, now))
+		}
+		// a volume with a problem degrades the database, it is still running but needs attention
+		for _, volume := range operators[i].Volumes {
+			if volume.Reason != "" && operators[i].State == model.StateReady {
+				operators[i].State = model.StateDegraded
+			}
+		}
+	}
+}
+
+// usageBucket returns the usage percentage rounded down to a step
+func usageBucket(usage VolumeUsage) float64 {
+	if usage.CapacityBytes <= 0 {
+		return 0
+	}
+	percentage := float64(usage.UsedBytes) / float64(usage.CapacityBytes) * 100
+	return math.Floor(percentage/volumeUsageStep) * volumeUsageStep
+}
+
+func aboveThreshold(usage VolumeUsage) bool {
+	return usage.CapacityBytes > 0 && float64(usage.UsedBytes) >= float64(usage.CapacityBytes)*volumeUsageThreshold
+}
@@ -0,0 +1,126 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func testClaim(name string, phase corev1.PersistentVolumeClaimPhase, created time.Time) *corev1.PersistentVolumeClaim {
+	storageClass := "standard"
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "infrastructure", CreationTimestamp: metav1.NewTime(created)},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+			Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{Phase: phase},
+	}
+}
+
+func claimVolume(claim string) corev1.Volume {
+	return corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}}}
+}
+
+func TestVolumeState(t *testing.T) {
+	now := time.Now()
+	bound := testClaim("postgres-data", corev1.ClaimBound, now.Add(-time.Hour))
+	bound.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")}
+
+	tests := []struct {
+		name   string
+		pvc    *corev1.PersistentVolumeClaim
+		usage  map[string]VolumeUsage
+		reason string
+	}{
+		{name: "bound", pvc: bound, usage: map[string]VolumeUsage{"infrastructure/postgres-data": {UsedBytes: 100, CapacityBytes: 1000}}},
+		{name: "almost full", pvc: bound, usage: map[string]VolumeUsage{"infrastructure/postgres-data": {UsedBytes: 900, CapacityBytes: 1000}}, reason: "VolumeAlmostFull"},
+		{name: "pending", pvc: testClaim("postgres-data", corev1.ClaimPending, now.Add(-time.Minute))},
+		{name: "stuck pending", pvc: testClaim("postgres-data", corev1.ClaimPending, now.Add(-time.Hour)), reason: "VolumePending"},
+		{name: "lost", pvc: testClaim("postgres-data", corev1.ClaimLost, now.Add(-time.Hour)), reason: "VolumeLost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := VolumeState(tt.pvc, tt.usage, now)
+			assert.Equal(t, "postgres-data", state.Name)
+			assert.Equal(t, string(tt.pvc.Status.Phase), state.Phase)
+			assert.Equal(t, "standard", state.StorageClass)
+			assert.Equal(t, tt.reason, state.Reason)
+			if tt.usage == nil {
+				assert.Nil(t, state.UsagePercentage)
+			} else {
+				assert.Equal(t, float64(tt.usage["infrastructure/postgres-data"].UsedBytes)/10, *state.UsagePercentage)
+			}
+		})
+	}
+
+	// the capacity of the bound volume is used over the request
+	assert.Equal(t, int64(2*1024*1024*1024), VolumeState(bound, nil, now).CapacityBytes)
+	assert.Equal(t, int64(1024*1024*1024), VolumeState(testClaim("new", corev1.ClaimPending, now), nil, now).CapacityBytes)
+}
+
+func TestAddVolumes(t *testing.T) {
+	now := time.Now()
+	database := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "infrastructure", Labels: map[string]string{"kapeta.com/block-id": "postgres-id"}},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{claimVolume("postgres-data"), claimVolume("postgres-wal"), {Name: "config"}},
+		}}},
+	}
+	operators := []model.OperatorState{{ID: "postgres-id", Name: "postgres", State: model.StateReady}, {ID: "mongo-id", Name: "mongo", State: model.StateReady}}
+
+	addVolumes(operators, []*appsv1.Deployment{database}, []*corev1.PersistentVolumeClaim{testClaim("postgres-data", corev1.ClaimBound, now)}, nil, now)
+	assert.Len(t, operators[0].Volumes, 2)
+	assert.Equal(t, "postgres-data", operators[0].Volumes[0].Name)
+	assert.Equal(t, "Bound", operators[0].Volumes[0].Phase)
+	assert.Equal(t, "postgres-wal", operators[0].Volumes[1].Name)
+	assert.Equal(t, "ClaimNotFound", operators[0].Volumes[1].Reason)
+	assert.Equal(t, model.StateDegraded, operators[0].State)
+	assert.Nil(t, operators[1].Volumes)
+	assert.Equal(t, model.StateReady, operators[1].State)
+}
+
+func TestVolumeStats(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-0", Namespace: "infrastructure"},
+		Spec:       corev1.PodSpec{NodeName: "node-1", Volumes: []corev1.Volume{claimVolume("postgres-data")}},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(pod))
+
+	changed := false
+	stats := newVolumeStats(nil, corelisters.NewPodLister(indexer), func() { changed = true })
+	nodes := []string{}
+	stats.fetch = func(ctx context.Context, node string) ([]byte, error) {
+		nodes = append(nodes, node)
+		return []byte(`{"pods": [{"volume": [
+			{"name": "data", "usedBytes": 900, "capacityBytes": 1000, "pvcRef": {"name": "postgres-data", "namespace": "infrastructure"}},
+			{"name": "tmp", "usedBytes": 10, "capacityBytes": 1000}
+		]}]}`), nil
+	}
+
+	stats.refresh(context.Background())
+	assert.Equal(t, []string{"node-1"}, nodes)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]VolumeUsage{"infrastructure/postgres-data": {UsedBytes: 900, CapacityBytes: 1000}}, stats.lastUsage())
+
+	// a small change of usage doesn't signal a change
+	changed = false
+	stats.fetch = func(ctx context.Context, node string) ([]byte, error) {
+		return []byte(`{"pods": [{"volume": [
+			{"name": "data", "usedBytes": 912, "capacityBytes": 1000, "pvcRef": {"name": "postgres-data", "namespace": "infrastructure"}}
+		]}]}`), nil
+	}
+	stats.refresh(context.Background())
+	assert.False(t, changed)
+	assert.Equal(t, 90.0, usageBucket(stats.lastUsage()["infrastructure/postgres-data"]))
+}
@@ -0,0 +1,233 @@
+package status
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+)
+
+const (
+	// the number of events kept to let clients resume with Last-Event-ID
+	historySize = 256
+	// changes arriving within this delay are sent as one update
+	debounceDelay    = 250 * time.Millisecond
+	subscriberBuffer = 64
+)
+
+// The event types of the status stream
+const (
+	EventStatus   = "status"
+	EventInstance = "instance"
+	EventOperator = "operator"
+	// sent on the rollout stream only
+	EventRollout = "rollout"
+)
+
+// The actions of instance and operator change events
+const (
+	ActionUpdated = "updated"
+	ActionRemoved = "removed"
+)
+
+// Event is a single event of the status stream
+type Event struct {
+	ID   uint64
+	Type string
+	Data interface{}
+}
+
+type InstanceChange struct {
+	Action   string              `json:"action"`
+	Instance model.InstanceState `json:"instance"`
+}
+
+type OperatorChange struct {
+	Action   string              `json:"action"`
+	Operator model.OperatorState `json:"operator"`
+}
+
+// Broadcaster rebuilds the status when the cache changes, or periodically to pick up operator
+// state, and sends the differences to the subscribers of the status stream
+type Broadcaster struct {
+	cache   *Cache
+	refresh time.Duration
+
+	mu          sync.Mutex
+	last        *model.ClusterStatus
+	epoch       uint64
+	nextID      uint64
+	history     []Event
+	subscribers map[chan Event]struct{}
+}
+
+// NewBroadcaster numbers the events from the start time of the process, so the ids of an earlier
+// process are always lower and a client resuming with one of them gets the full status
+func NewBroadcaster(cache *Cache, refresh time.Duration) *Broadcaster {
+	// milliseconds times a thousand stays within the integers a javascript client can parse
+	epoch := uint64(time.Now().UnixMilli()) * 1000
+	return &Broadcaster{
+		cache:       cache,
+		refresh:     refresh,
+		epoch:       epoch,
+		nextID:      epoch + 1,
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// Start updates the status on every change until the context is cancelled
+func (b *Broadcaster) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(b.refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-b.cache.Changed():
+				time.Sleep(debounceDelay)
+			}
+			b.update()
+		}
+	}()
+}
+
+func (b *Broadcaster) update() {
+	clusterStatus, err := b.cache.ClusterStatus()
+	if err != nil {
+		if err != ErrNotSynced {
+			log.Printf("error building status for the status stream: %v\n", err)
+		}
+		return
+	}
+	b.publish(clusterStatus)
+}
+
+// publish sends the changes between the last and the new status to the subscribers
+func (b *Broadcaster) publish(clusterStatus *model.ClusterStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, event := range diffStatus(b.last, clusterStatus) {
+		event.ID = b.nextID
+		b.nextID++
+		b.history = append(b.history, event)
+		if len(b.history) > historySize {
+			b.history = b.history[len(b.history)-historySize:]
+		}
+		for ch := range b.subscribers {
+			select {
+			case ch <- event:
+			default:
+				// the subscriber can't keep up, it will have to reconnect and resume
+				delete(b.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+	b.last = clusterStatus
+}
+
+// Subscribe returns the events a client has to receive first, followed by the channel of
+// future events. Clients resuming with a lastEventID that is still in the history only get the
+// events they missed, everyone else starts with the full status. Call cancel when done.
+func (b *Broadcaster) Subscribe(lastEventID string) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	initial := []Event{}
+	if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil && b.canResume(id) {
+		for _, event := range b.history {
+			if event.ID > id {
+				initial = append(initial, event)
+			}
+		}
+	} else if b.last != nil {
+		initial = append(initial, Event{ID: b.nextID - 1, Type: EventStatus, Data: b.last})
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return initial, ch, cancel
+}
+
+func (b *Broadcaster) canResume(id uint64) bool {
+	if id <= b.epoch || id >= b.nextID {
+		return false
+	}
+	if len(b.history) == 0 {
+		return id == b.nextID-1
+	}
+	return id >= b.history[0].ID-1
+}
+
+// diffStatus returns the events that turn the previous status into the next one, a change of
+// the environment itself, like a new version, is sent as a full status
+func diffStatus(prev *model.ClusterStatus, next *model.ClusterStatus) []Event {
+	if prev == nil || environmentChanged(prev, next) {
+		return []Event{{Type: EventStatus, Data: next}}
+	}
+	events := []Event{}
+
+	prevInstances := map[string]model.InstanceState{}
+	for _, instance := range prev.Instances {
+		prevInstances[InstanceKey(instance)] = instance
+	}
+	nextInstances := map[string]bool{}
+	for _, instance := range next.Instances {
+		key := InstanceKey(instance)
+		nextInstances[key] = true
+		if old, ok := prevInstances[key]; !ok || !reflect.DeepEqual(old, instance) {
+			events = append(events, Event{Type: EventInstance, Data: InstanceChange{Action: ActionUpdated, Instance: instance}})
+		}
+	}
+	for _, instance := range prev.Instances {
+		if !nextInstances[InstanceKey(instance)] {
+			events = append(events, Event{Type: EventInstance, Data: InstanceChange{Action: ActionRemoved, Instance: instance}})
+		}
+	}
+
+	prevOperators := map[string]model.OperatorState{}
+	for _, operator := range prev.Operators {
+		prevOperators[operator.ID] = operator
+	}
+	nextOperators := map[string]bool{}
+	for _, operator := range next.Operators {
+		nextOperators[operator.ID] = true
+		if old, ok := prevOperators[operator.ID]; !ok || !reflect.DeepEqual(old, operator) {
+			events = append(events, Event{Type: EventOperator, Data: OperatorChange{Action: ActionUpdated, Operator: operator}})
+		}
+	}
+	for _, operator := range prev.Operators {
+		if !nextOperators[operator.ID] {
+			events = append(events, Event{Type: EventOperator, Data: OperatorChange{Action: ActionRemoved, Operator: operator}})
+		}
+	}
+	return events
+}
+
+func environmentChanged(prev *model.ClusterStatus, next *model.ClusterStatus) bool {
+	return prev.EnvironmentName != next.EnvironmentName || prev.EnvironmentVersion != next.EnvironmentVersion ||
+		prev.PlanName != next.PlanName || prev.PlanVersion != next.PlanVersion ||
+		prev.TargetName != next.TargetName || prev.TargetVersion != next.TargetVersion
+}
+
+// InstanceKey identifies an instance in the stream, gateways of different providers may share a name
+func InstanceKey(instance model.InstanceState) string {
+	if provider := instance.Metadata["kapeta.com/provider"]; provider != "" {
+		return instance.Type + "/" + provider + "/" + instance.Name
+	}
+	return instance.Type + "/" + instance.Name
+}
@@ -0,0 +1,138 @@
+package status
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStatus(version string, instances ...model.InstanceState) *model.ClusterStatus {
+	return &model.ClusterStatus{EnvironmentName: "production", EnvironmentVersion: version, Instances: instances}
+}
+
+func TestDiffStatus(t *testing.T) {
+	ready := model.InstanceState{Name: "todo", Type: model.TypeBlock, State: model.StateReady}
+	degraded := model.InstanceState{Name: "todo", Type: model.TypeBlock, State: model.StateDegraded}
+	gateway := model.InstanceState{Name: "todo", Type: model.TypeGateway, State: model.StateReady}
+
+	t.Run("first status", func(t *testing.T) {
+		events := diffStatus(nil, testStatus("1", ready))
+		assert.Len(t, events, 1)
+		assert.Equal(t, EventStatus, events[0].Type)
+	})
+	t.Run("unchanged", func(t *testing.T) {
+		assert.Empty(t, diffStatus(testStatus("1", ready, gateway), testStatus("1", ready, gateway)))
+	})
+	t.Run("instance updated", func(t *testing.T) {
+		events := diffStatus(testStatus("1", ready, gateway), testStatus("1", degraded, gateway))
+		assert.Len(t, events, 1)
+		assert.Equal(t, EventInstance, events[0].Type)
+		assert.Equal(t, InstanceChange{Action: ActionUpdated, Instance: degraded}, events[0].Data)
+	})
+	t.Run("instance removed", func(t *testing.T) {
+		events := diffStatus(testStatus("1", ready, gateway), testStatus("1", gateway))
+		assert.Len(t, events, 1)
+		assert.Equal(t, InstanceChange{Action: ActionRemoved, Instance: ready}, events[0].Data)
+	})
+	t.Run("operator added", func(t *testing.T) {
+		next := testStatus("1", ready)
+		next.Operators = []model.OperatorState{{ID: "db-1", Name: "mongodb", State: "Ready"}}
+		events := diffStatus(testStatus("1", ready), next)
+		assert.Len(t, events, 1)
+		assert.Equal(t, EventOperator, events[0].Type)
+	})
+	t.Run("new environment version", func(t *testing.T) {
+		events := diffStatus(testStatus("1", ready), testStatus("2", ready))
+		assert.Len(t, events, 1)
+		assert.Equal(t, EventStatus, events[0].Type)
+	})
+}
+
+func TestBroadcasterSubscribe(t *testing.T) {
+	ready := model.InstanceState{Name: "todo", Type: model.TypeBlock, State: model.StateReady}
+	degraded := model.InstanceState{Name: "todo", Type: model.TypeBlock, State: model.StateDegraded}
+
+	b := NewBroadcaster(nil, 0)
+	initial, _, cancel := b.Subscribe("")
+	assert.Empty(t, initial)
+	cancel()
+
+	b.publish(testStatus("1", ready))
+	_, events, cancel := b.Subscribe("")
+	defer cancel()
+	b.publish(testStatus("1", degraded))
+	event := <-events
+	assert.Equal(t, b.epoch+2, event.ID)
+	assert.Equal(t, EventInstance, event.Type)
+
+	t.Run("new subscribers get the full status", func(t *testing.T) {
+		initial, _, cancel := b.Subscribe("")
+		defer cancel()
+		assert.Len(t, initial, 1)
+		assert.Equal(t, EventStatus, initial[0].Type)
+		assert.Equal(t, b.epoch+2, initial[0].ID)
+	})
+	t.Run("resume with the missed events", func(t *testing.T) {
+		initial, _, cancel := b.Subscribe(strconv.FormatUint(b.epoch+1, 10))
+		defer cancel()
+		assert.Len(t, initial, 1)
+		assert.Equal(t, b.epoch+2, initial[0].ID)
+	})
+	t.Run("up to date", func(t *testing.T) {
+		initial, _, cancel := b.Subscribe(strconv.FormatUint(b.epoch+2, 10))
+		defer cancel()
+		assert.Empty(t, initial)
+	})
+	t.Run("unknown id", func(t *testing.T) {
+		initial, _, cancel := b.Subscribe(strconv.FormatUint(b.epoch+100, 10))
+		defer cancel()
+		assert.Len(t, initial, 1)
+		assert.Equal(t, EventStatus, initial[0].Type)
+	})
+	t.Run("id of an earlier process", func(t *testing.T) {
+		// a restart that published as many events doesn't make the old ids resumable
+		initial, _, cancel := b.Subscribe("2")
+		defer cancel()
+		assert.Len(t, initial, 1)
+		assert.Equal(t, EventStatus, initial[0].Type)
+
+		time.Sleep(time.Millisecond)
+		restarted := NewBroadcaster(nil, 0)
+		assert.Greater(t, restarted.epoch, b.epoch)
+		assert.False(t, restarted.canResume(b.epoch+2))
+	})
+	t.Run("slow subscribers are dropped", func(t *testing.T) {
+		_, events, cancel := b.Subscribe("")
+		defer cancel()
+		for i := 0; i <= subscriberBuffer; i++ {
+			state := model.StateReady
+			if i%2 == 1 {
+				state = model.StateDegraded
+			}
+			b.publish(testStatus("1", model.InstanceState{Name: "todo", Type: model.TypeBlock, State: state}))
+		}
+		count := 0
+		for range events {
+			count++
+		}
+		assert.Equal(t, subscriberBuffer, count)
+	})
+}
+
+func TestInstanceKey(t *testing.T) {
+	ingress := model.InstanceState{Type: model.TypeGateway, Name: "todo", Metadata: map[string]string{"kapeta.com/provider": "ingress"}}
+	route := model.InstanceState{Type: model.TypeGateway, Name: "todo", Metadata: map[string]string{"kapeta.com/provider": "gateway-api"}}
+	assert.NotEqual(t, InstanceKey(ingress), InstanceKey(route))
+	assert.Equal(t, "block/todo", InstanceKey(model.InstanceState{Type: model.TypeBlock, Name: "todo"}))
+
+	// both gateways are kept apart in the diff
+	prev := &model.ClusterStatus{Instances: []model.InstanceState{ingress, route}}
+	next := &model.ClusterStatus{Instances: []model.InstanceState{ingress}}
+	events := diffStatus(prev, next)
+	assert.Len(t, events, 1)
+	assert.Equal(t, ActionRemoved, events[0].Data.(InstanceChange).Action)
+	assert.Equal(t, "gateway-api", events[0].Data.(InstanceChange).Instance.Metadata["kapeta.com/provider"])
+}
@@ -0,0 +1,146 @@
+package status
+
+import (
+	"strings"
+
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+)
+
+// BuildTopology builds the graph of the services and network connections of the deployment descriptor,
+// the nodes get the live state of their instances and operators. Gateways that don't belong to a
+// service of the deployment get a node of their own.
+func BuildTopology(deployment *kapetamodel.Deployment, clusterStatus *model.ClusterStatus) model.Topology {
+	topology := model.Topology{
+		EnvironmentName:    clusterStatus.EnvironmentName,
+		EnvironmentVersion: clusterStatus.EnvironmentVersion,
+		Nodes:              []model.TopologyNode{},
+		Edges:              []model.TopologyEdge{},
+	}
+
+	instances := map[string][]model.InstanceState{}
+	for _, instance := range clusterStatus.Instances {
+		instances[instance.BlockID] = append(instances[instance.BlockID], instance)
+	}
+	operators := map[string]model.OperatorState{}
+	for _, operator := range clusterStatus.Operators {
+		operators[operator.ID] = operator
+	}
+
+	healthy := map[string]bool{}
+	planned := map[string]bool{}
+	for _, svc := range deployment.Spec.Services {
+		planned[svc.Id] = true
+		node := model.TopologyNode{
+			ID:        svc.Id,
+			Name:      serviceTitle(svc),
+			Type:      nodeType(svc),
+			Kind:      svc.Kind,
+			Ref:       svc.Ref,
+			Instances: []model.InstanceState{},
+		}
+		if node.Type == model.NodeOperator {
+			if operator, found := operators[svc.Id]; found {
+				node.State = operator.State
+			} else {
+				node.Reason, node.Message = "NotFound", "no database was found for the service"
+			}
+		} else {
+			node.Instances = append(node.Instances, instances[svc.Id]...)
+			setNodeState(&node)
+		}
+		node.Healthy = healthyState(node.State)
+		healthy[node.ID] = node.Healthy
+		topology.Nodes = append(topology.Nodes, node)
+	}
+	for _, instance := range clusterStatus.Instances {
+		if instance.Type != model.TypeGateway || planned[instance.BlockID] {
+			continue
+		}
+		node := model.TopologyNode{
+			ID:        InstanceKey(instance),
+			Name:      instance.Name,
+			Type:      model.NodeGateway,
+			Instances: []model.InstanceState{instance},
+		}
+		setNodeState(&node)
+		node.Healthy = healthyState(node.State)
+		topology.Nodes = append(topology.Nodes, node)
+	}
+
+	for _, connection := range deployment.Spec.Network {
+		edge := model.TopologyEdge{
+			Source:   connection.Consumer.Id,
+			Target:   connection.Provider.Id,
+			Type:     string(connection.Type),
+			PortType: connection.Port.Type,
+			Healthy:  healthy[connection.Provider.Id],
+		}
+		if connection.Consumer.Resource != nil {
+			edge.SourceResource = *connection.Consumer.Resource
+		}
+		if connection.Provider.Resource != nil {
+			edge.TargetResource = *connection.Provider.Resource
+		}
+		topology.Edges = append(topology.Edges, edge)
+	}
+	return topology
+}
+
+func nodeType(svc kapetamodel.DeploymentServiceInstance) string {
+	switch {
+	case svc.Type == kapetamodel.Operator:
+		return model.NodeOperator
+	case strings.Contains(svc.Kind, "gateway"):
+		return model.NodeGateway
+	}
+	return model.NodeBlock
+}
+
+// setNodeState sets the state of the node to the worst state of its instances. The jobs and
+// cronjobs of a block don't serve its consumers, so they only count when it has nothing else.
+func setNodeState(node *model.TopologyNode) {
+	if len(node.Instances) == 0 {
+		node.Reason, node.Message = "NotFound", "no instances are running for the service"
+		return
+	}
+	serving := []model.InstanceState{}
+	for _, instance := range node.Instances {
+		if instance.Type != model.TypeJob && instance.Type != model.TypeCronJob {
+			serving = append(serving, instance)
+		}
+	}
+	if len(serving) == 0 {
+		serving = node.Instances
+	}
+	worst := serving[0]
+	for _, instance := range serving[1:] {
+		if stateSeverity(instance.State) > stateSeverity(worst.State) {
+			worst = instance
+		}
+	}
+	node.State, node.Reason, node.Message = worst.State, worst.Reason, worst.Message
+}
+
+// healthyState tells if a dependency in the state can serve its consumers, a provider
+// scaled to zero can't even though it was scaled down on purpose
+func healthyState(state string) bool {
+	switch state {
+	case model.StateReady, model.StateRunning, model.StateCompleted, model.StateSuspended:
+		return true
+	}
+	return false
+}
+
+// stateSeverity orders the states from healthy to failed
+func stateSeverity(state string) int {
+	switch state {
+	case model.StateFailed, model.StateCrashLooping, model.StateImagePullError:
+		return 3
+	case model.StateDegraded, model.StatePending:
+		return 2
+	case model.StateProgressing:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	kapetamodel "github.com/kapetacom/schemas/packages/go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTopology(t *testing.T) {
+	resource := "todos"
+	deployment := &kapetamodel.Deployment{}
+	deployment.Spec.Services = []kapetamodel.DeploymentServiceInstance{
+		{Id: "gateway-1", Kind: "kapeta/block-type-gateway-http", Ref: "kapeta/gateway:1.0.0"},
+		{Id: "block-1", Kind: "kapeta/block-type-service", Ref: "kapeta/todo:1.0.0"},
+		{Id: "block-2", Kind: "kapeta/block-type-service", Ref: "kapeta/users:1.0.0"},
+		{Id: "db-1", Kind: "kapeta/resource-type-postgresql", Ref: "kapeta/postgresql:1.0.0", Type: kapetamodel.Operator},
+	}
+	deployment.Spec.Network = []kapetamodel.DeploymentNetworkConnection{
+		{Consumer: kapetamodel.DeploymentNetworkEndpoint{Id: "gateway-1"}, Provider: kapetamodel.DeploymentNetworkEndpoint{Id: "block-1"}, Type: kapetamodel.DeploymentNetworkConnectionTypeService},
+		{Consumer: kapetamodel.DeploymentNetworkEndpoint{Id: "block-1"}, Provider: kapetamodel.DeploymentNetworkEndpoint{Id: "db-1", Resource: &resource}, Type: kapetamodel.Resource, Port: kapetamodel.Port{Type: "postgres"}},
+	}
+	clusterStatus := &model.ClusterStatus{
+		EnvironmentName: "production",
+		Instances: []model.InstanceState{
+			{Type: model.TypeGateway, Name: "todo-gateway", BlockID: "gateway-1", State: model.StateReady},
+			{Type: model.TypeBlock, Name: "todo", BlockID: "block-1", State: model.StateReady},
+			{Type: model.TypeGateway, Name: "todo-route", BlockID: "block-1", State: model.StateDegraded, Reason: "NoReadyEndpoints"},
+			{Type: model.TypeGateway, Name: "legacy", State: model.StateReady},
+		},
+		Operators: []model.OperatorState{{ID: "db-1", Name: "todos", State: model.StateFailed}},
+	}
+
+	topology := BuildTopology(deployment, clusterStatus)
+	assert.Equal(t, "production", topology.EnvironmentName)
+	assert.Len(t, topology.Nodes, 5)
+
+	nodes := map[string]model.TopologyNode{}
+	for _, node := range topology.Nodes {
+		nodes[node.ID] = node
+	}
+	assert.Equal(t, model.NodeGateway, nodes["gateway-1"].Type)
+	assert.True(t, nodes["gateway-1"].Healthy)
+
+	assert.Equal(t, model.NodeBlock, nodes["block-1"].Type)
+	assert.Equal(t, model.StateDegraded, nodes["block-1"].State)
+	assert.Equal(t, "NoReadyEndpoints", nodes["block-1"].Reason)
+	assert.Len(t, nodes["block-1"].Instances, 2)
+
+	assert.Equal(t, "NotFound", nodes["block-2"].Reason)
+	assert.False(t, nodes["block-2"].Healthy)
+
+	assert.Equal(t, model.NodeOperator, nodes["db-1"].Type)
+	assert.Equal(t, model.StateFailed, nodes["db-1"].State)
+
+	assert.Equal(t, model.NodeGateway, nodes["gateway/legacy"].Type)
+
+	assert.Equal(t, []model.TopologyEdge{
+		{Source: "gateway-1", Target: "block-1", Type: "service", Healthy: false},
+		{Source: "block-1", Target: "db-1", TargetResource: "todos", Type: "resource", PortType: "postgres", Healthy: false},
+	}, topology.Edges)
+}
+
+func TestTopologyIgnoresJobs(t *testing.T) {
+	deployment := &kapetamodel.Deployment{}
+	deployment.Spec.Services = []kapetamodel.DeploymentServiceInstance{
+		{Id: "block-1", Kind: "kapeta/block-type-service", Ref: "kapeta/todo:1.0.0"},
+		{Id: "block-2", Kind: "kapeta/block-type-service", Ref: "kapeta/users:1.0.0"},
+		{Id: "block-3", Kind: "kapeta/block-type-service", Ref: "kapeta/reports:1.0.0"},
+	}
+	deployment.Spec.Network = []kapetamodel.DeploymentNetworkConnection{
+		{Consumer: kapetamodel.DeploymentNetworkEndpoint{Id: "block-2"}, Provider: kapetamodel.DeploymentNetworkEndpoint{Id: "block-1"}, Type: kapetamodel.DeploymentNetworkConnectionTypeService},
+	}
+	clusterStatus := &model.ClusterStatus{
+		Instances: []model.InstanceState{
+			{Type: model.TypeBlock, Name: "todo", BlockID: "block-1", State: model.StateReady},
+			{Type: model.TypeJob, Name: "todo-migrate", BlockID: "block-1", State: model.StateFailed, Reason: "BackoffLimitExceeded"},
+			{Type: model.TypeCronJob, Name: "todo-cleanup", BlockID: "block-1", State: model.StatePending, Reason: "NotScheduledYet"},
+			{Type: model.TypeBlock, Name: "users", BlockID: "block-2", State: model.StateReady},
+			{Type: model.TypeJob, Name: "reports", BlockID: "block-3", State: model.StateFailed},
+		},
+	}
+
+	topology := BuildTopology(deployment, clusterStatus)
+	nodes := map[string]model.TopologyNode{}
+	for _, node := range topology.Nodes {
+		nodes[node.ID] = node
+	}
+	// the failed job and the pending cronjob are shown but don't make the block unhealthy
+	assert.Len(t, nodes["block-1"].Instances, 3)
+	assert.Equal(t, model.StateReady, nodes["block-1"].State)
+	assert.True(t, nodes["block-1"].Healthy)
+	assert.True(t, topology.Edges[0].Healthy)
+
+	// a block that only runs a job has the state of the job
+	assert.Equal(t, model.StateFailed, nodes["block-3"].State)
+	assert.False(t, nodes["block-3"].Healthy)
+}
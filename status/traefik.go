@@ -0,0 +1,258 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	corev1 "k8s.io/api/core/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+var pathMatcher = regexp.MustCompile("Path(?:Prefix)?\\(([^)]*)\\)")
+
+// TraefikView keeps the gateway states built from the routers and services of the Traefik API,
+// it is used instead of the VirtualServices on clusters without Istio
+type TraefikView struct {
+	fetch    func(ctx context.Context, path string) ([]byte, error)
+	interval time.Duration
+	changed  func()
+
+	mu      sync.RWMutex
+	states  []model.InstanceState
+	updated time.Time
+}
+
+// NewTraefikView reads the Traefik API from TRAEFIK_API_URL if set, otherwise through the service
+// proxy of the API server using TRAEFIK_NAMESPACE, TRAEFIK_SERVICE and TRAEFIK_API_PORT
+func NewTraefikView(clientset k8s.Interface, interval time.Duration, changed func()) *TraefikView {
+	v := &TraefikView{interval: interval, changed: changed, states: []model.InstanceState{}}
+	if url := os.Getenv("TRAEFIK_API_URL"); url != "" {
+		client := &http.Client{Timeout: 10 * time.Second}
+		v.fetch = func(ctx context.Context, path string) ([]byte, error) {
+			return httpGet(ctx, client, strings.TrimSuffix(url, "/")+path)
+		}
+		return v
+	}
+	namespace := envOrDefault("TRAEFIK_NAMESPACE", "kube-system")
+	service := envOrDefault("TRAEFIK_SERVICE", "traefik")
+	port := envOrDefault("TRAEFIK_API_PORT", "traefik")
+	v.fetch = func(ctx context.Context, path string) ([]byte, error) {
+		return clientset.CoreV1().Services(namespace).ProxyGet("http", service, port, path, nil).DoRaw(ctx)
+	}
+	return v
+}
+
+// Start refreshes the view every interval until the context is cancelled
+func (v *TraefikView) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+		for {
+			v.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (v *TraefikView) refresh(ctx context.Context) {
+	routes := model.TraefikRoutes{}
+	if err := v.get(ctx, "/api/http/routers", &routes); err != nil {
+		log.Printf("error getting traefik routers: %v\n", err)
+		return
+	}
+	services := []model.TraefikService{}
+	if err := v.get(ctx, "/api/http/services", &services); err != nil {
+		log.Printf("error getting traefik services: %v\n", err)
+		return
+	}
+	states := TraefikGatewayStates(routes, services)
+
+	v.mu.Lock()
+	changed := !reflect.DeepEqual(v.states, states)
+	v.states = states
+	v.updated = time.Now()
+	v.mu.Unlock()
+	if changed && v.changed != nil {
+		v.changed()
+	}
+}
+
+func (v *TraefikView) get(ctx context.Context, path string, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	data, err := v.fetch(ctx, path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// Gateways returns a copy of the gateway states of the last refresh
+func (v *TraefikView) Gateways() []model.InstanceState {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	states := make([]model.InstanceState, len(v.states))
+	for i, state := range v.states {
+		state.Metadata = maps.Clone(state.Metadata)
+		states[i] = state
+	}
+	return states
+}
+
+// Updated returns the time of the last successful refresh
+func (v *TraefikView) Updated() time.Time {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.updated
+}
+
+// addTraefikBlockIDs resolves the blocks of the gateways from the kubernetes services behind them,
+// the kubernetes providers of Traefik name a service <namespace>-<name>-<port>@<provider>
+func addTraefikBlockIDs(states []model.InstanceState, services []*corev1.Service) {
+	for i := range states {
+		name, _, _ := strings.Cut(states[i].Metadata["kapeta.com/destinations"], "@")
+		for _, svc := range services {
+			if blockID := svc.Labels["kapeta.com/block-id"]; blockID != "" && traefikServiceOf(name, svc) {
+				states[i].BlockID = blockID
+				break
+			}
+		}
+	}
+}
+
+func traefikServiceOf(name string, svc *corev1.Service) bool {
+	port, ok := strings.CutPrefix(name, svc.Namespace+"-"+svc.Name+"-")
+	if !ok {
+		return false
+	}
+	for _, p := range svc.Spec.Ports {
+		if port == p.Name || port == strconv.Itoa(int(p.Port)) {
+			return true
+		}
+	}
+	return false
+}
+
+// TraefikGatewayStates maps the routers to gateway states, a router is ready when it is enabled
+// and the servers of its service are up. Traefik's own routers, like the dashboard, are skipped.
+func TraefikGatewayStates(routes model.TraefikRoutes, services []model.TraefikService) []model.InstanceState {
+	byName := map[string]model.TraefikService{}
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	result := []model.InstanceState{}
+	for _, route := range routes {
+		if route.Provider == "internal" {
+			continue
+		}
+		state := model.InstanceState{
+			Type:     model.TypeGateway,
+			Name:     route.Name,
+			State:    model.StateReady,
+			Metadata: map[string]string{"kapeta.com/provider": "traefik", "kapeta.com/rule": route.Rule},
+		}
+		if len(route.EntryPoints) > 0 {
+			state.Metadata["kapeta.com/entrypoints"] = strings.Join(route.EntryPoints, ",")
+		}
+		if paths := rulePaths(route.Rule); len(paths) > 0 {
+			state.Metadata["kapeta.com/api_path"] = paths[0]
+			state.Metadata["kapeta.com/api_paths"] = strings.Join(paths, ",")
+		}
+
+		// services of the same provider are referenced without the @provider suffix
+		serviceName := route.Service
+		if !strings.Contains(serviceName, "@") {
+			serviceName = serviceName + "@" + route.Provider
+		}
+		state.Metadata["kapeta.com/destinations"] = serviceName
+		svc, found := byName[serviceName]
+
+		switch {
+		case route.Status == "disabled":
+			state.State, state.Reason, state.Message = model.StateFailed, "RouterDisabled", fmt.Sprintf("router %v is disabled", route.Name)
+		case !found:
+			state.State, state.Reason, state.Message = model.StateFailed, "ServiceNotFound", fmt.Sprintf("service %v does not exist", serviceName)
+		case svc.Status == "disabled":
+			state.State, state.Reason, state.Message = model.StateFailed, "ServiceDisabled", fmt.Sprintf("service %v is disabled", serviceName)
+		default:
+			state.State, state.Reason, state.Message = serverHealth(serviceName, svc.ServerStatus)
+			if state.State == model.StateReady && route.Status == "warning" {
+				state.State, state.Reason, state.Message = model.StateDegraded, "RouterWarning", fmt.Sprintf("router %v has warnings", route.Name)
+			}
+		}
+		result = append(result, state)
+	}
+	return result
+}
+
+// serverHealth is only known for services with a health check, without one
+// Traefik doesn't report the server status
+func serverHealth(serviceName string, serverStatus map[string]string) (string, string, string) {
+	down := []string{}
+	for url, status := range serverStatus {
+		if status != "UP" {
+			down = append(down, url)
+		}
+	}
+	switch {
+	case len(down) == 0:
+		return model.StateReady, "", ""
+	case len(down) == len(serverStatus):
+		return model.StateFailed, "NoHealthyServers", fmt.Sprintf("all servers of %v are down", serviceName)
+	}
+	return model.StateDegraded, "ServersDown", fmt.Sprintf("%d of %d servers of %v are down", len(down), len(serverStatus), serviceName)
+}
+
+// rulePaths returns the paths of the Path and PathPrefix matchers of a router rule
+func rulePaths(rule string) []string {
+	paths := []string{}
+	for _, match := range pathMatcher.FindAllStringSubmatch(rule, -1) {
+		for _, path := range strings.Split(match[1], ",") {
+			if path = strings.Trim(strings.TrimSpace(path), "`\"'"); path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+func httpGet(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from %v", res.Status, url)
+	}
+	return io.ReadAll(res.Body)
+}
+
+func envOrDefault(name string, defaultValue string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return defaultValue
+}
@@ -0,0 +1,84 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const traefikRouters = `[
+	{"entryPoints": ["web"], "service": "services-todo-80", "rule": "Host(` + "`todo.example.com`" + `) && PathPrefix(` + "`/api`, `/web`" + `)", "status": "enabled", "name": "todo@kubernetescrd", "provider": "kubernetescrd"},
+	{"entryPoints": ["web"], "service": "services-users-80", "rule": "Path(` + "`/users`" + `)", "status": "enabled", "name": "users@kubernetescrd", "provider": "kubernetescrd"},
+	{"entryPoints": ["web"], "service": "orders@file", "rule": "PathPrefix(` + "`/orders`" + `)", "status": "disabled", "name": "orders@kubernetescrd", "provider": "kubernetescrd"},
+	{"entryPoints": ["web"], "service": "missing", "rule": "PathPrefix(` + "`/missing`" + `)", "status": "enabled", "name": "missing@kubernetescrd", "provider": "kubernetescrd"},
+	{"entryPoints": ["traefik"], "service": "api@internal", "rule": "PathPrefix(` + "`/api`" + `)", "status": "enabled", "name": "api@internal", "provider": "internal"}
+]`
+
+const traefikServices = `[
+	{"name": "services-todo-80@kubernetescrd", "status": "enabled", "serverStatus": {"http://10.0.0.1:80": "UP", "http://10.0.0.2:80": "DOWN"}},
+	{"name": "services-users-80@kubernetescrd", "status": "enabled"},
+	{"name": "orders@file", "status": "enabled"}
+]`
+
+func TestTraefikGatewayStates(t *testing.T) {
+	routes := model.TraefikRoutes{}
+	assert.NoError(t, json.Unmarshal([]byte(traefikRouters), &routes))
+	services := []model.TraefikService{}
+	assert.NoError(t, json.Unmarshal([]byte(traefikServices), &services))
+
+	states := TraefikGatewayStates(routes, services)
+	assert.Len(t, states, 4)
+
+	assert.Equal(t, "todo@kubernetescrd", states[0].Name)
+	assert.Equal(t, model.StateDegraded, states[0].State)
+	assert.Equal(t, "ServersDown", states[0].Reason)
+	assert.Equal(t, "/api", states[0].Metadata["kapeta.com/api_path"])
+	assert.Equal(t, "/api,/web", states[0].Metadata["kapeta.com/api_paths"])
+
+	assert.Equal(t, model.StateReady, states[1].State)
+	assert.Equal(t, "/users", states[1].Metadata["kapeta.com/api_path"])
+
+	assert.Equal(t, model.StateFailed, states[2].State)
+	assert.Equal(t, "RouterDisabled", states[2].Reason)
+
+	assert.Equal(t, model.StateFailed, states[3].State)
+	assert.Equal(t, "ServiceNotFound", states[3].Reason)
+}
+
+func TestTraefikView(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/http/routers":
+			_, _ = w.Write([]byte(traefikRouters))
+		case "/api/http/services":
+			_, _ = w.Write([]byte(traefikServices))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("TRAEFIK_API_URL", server.URL)
+
+	changed := 0
+	view := NewTraefikView(nil, 0, func() { changed++ })
+	view.refresh(context.Background())
+	gateways := view.Gateways()
+	assert.Len(t, gateways, 4)
+	view.refresh(context.Background())
+	assert.Equal(t, 1, changed)
+
+	// the states are copies, changing them doesn't change the view
+	gateways[0].Metadata["kapeta.com/rule"] = "changed"
+	assert.NotEqual(t, "changed", view.Gateways()[0].Metadata["kapeta.com/rule"])
+
+	addTraefikBlockIDs(gateways, []*corev1.Service{blockService("todo", "block-1"), blockService("users-api", "block-2")})
+	assert.Equal(t, "block-1", gateways[0].BlockID)
+	assert.Empty(t, gateways[1].BlockID)
+	assert.Empty(t, gateways[2].BlockID)
+}
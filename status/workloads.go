@@ -0,0 +1,226 @@
+package status
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// StatefulSetState derives the state of a statefulset, pods of a statefulset become
+// ready one at a time so a partially ready set that is still creating pods is progressing
+func StatefulSetState(sts *appsv1.StatefulSet, pods []*corev1.Pod) model.InstanceState {
+	desiredReplicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		desiredReplicas = *sts.Spec.Replicas
+	}
+	state := model.InstanceState{
+		Type:            model.TypeStatefulSet,
+		Name:            sts.Name,
+		BlockID:         sts.GetObjectMeta().GetLabels()["kapeta.com/block-id"],
+		ReadyReplicas:   sts.Status.ReadyReplicas,
+		DesiredReplicas: desiredReplicas,
+	}
+	state.State, state.Reason, state.Message = statefulSetState(sts, desiredReplicas, pods)
+	return state
+}
+
+func statefulSetState(sts *appsv1.StatefulSet, desiredReplicas int32, pods []*corev1.Pod) (string, string, string) {
+	status := sts.Status
+	if desiredReplicas == 0 {
+		if status.Replicas > 0 {
+			return model.StateProgressing, "ScalingDown", fmt.Sprintf("%d pods are terminating", status.Replicas)
+		}
+		return model.StateScaledToZero, "ScaledToZero", "the statefulset is scaled to zero replicas"
+	}
+	if state, reason, message := podProblem(pods); state != "" {
+		return state, reason, message
+	}
+	if status.ObservedGeneration < sts.Generation {
+		return model.StateProgressing, "NewGeneration", "waiting for the new generation to be observed"
+	}
+	if status.UpdateRevision != "" && status.CurrentRevision != status.UpdateRevision {
+		return model.StateProgressing, "RollingUpdate", fmt.Sprintf("%d of %d replicas have been updated", status.UpdatedReplicas, desiredReplicas)
+	}
+	if status.ReadyReplicas >= desiredReplicas {
+		return model.StateReady, "", ""
+	}
+	if reason, message, pending := pendingReason(pods); pending && status.ReadyReplicas == 0 {
+		return model.StatePending, reason, message
+	}
+	if status.Replicas < desiredReplicas && sts.Spec.PodManagementPolicy != appsv1.ParallelPodManagement {
+		return model.StateProgressing, "OrderedReady", fmt.Sprintf("starting pod %d of %d", status.ReadyReplicas+1, desiredReplicas)
+	}
+	if status.ReadyReplicas > 0 {
+		return model.StateDegraded, "MinimumReplicasUnavailable", fmt.Sprintf("%d of %d replicas are ready", status.ReadyReplicas, desiredReplicas)
+	}
+	return model.StateFailed, "NoReadyReplicas", fmt.Sprintf("0 of %d replicas are ready", desiredReplicas)
+}
+
+// DaemonSetState derives the state of a daemonset from the pods scheduled on the nodes
+func DaemonSetState(ds *appsv1.DaemonSet, pods []*corev1.Pod) model.InstanceState {
+	status := ds.Status
+	state := model.InstanceState{
+		Type:            model.TypeDaemonSet,
+		Name:            ds.Name,
+		BlockID:         ds.GetObjectMeta().GetLabels()["kapeta.com/block-id"],
+		ReadyReplicas:   status.NumberReady,
+		DesiredReplicas: status.DesiredNumberScheduled,
+	}
+	problem, problemReason, problemMessage := podProblem(pods)
+	switch {
+	case status.DesiredNumberScheduled == 0:
+		state.State, state.Reason, state.Message = model.StateScaledToZero, "NoNodes", "no nodes match the daemonset"
+	case problem != "":
+		state.State, state.Reason, state.Message = problem, problemReason, problemMessage
+	case status.ObservedGeneration < ds.Generation || status.UpdatedNumberScheduled < status.DesiredNumberScheduled:
+		state.State, state.Reason = model.StateProgressing, "RollingUpdate"
+		state.Message = fmt.Sprintf("%d of %d pods have been updated", status.UpdatedNumberScheduled, status.DesiredNumberScheduled)
+	case status.NumberReady >= status.DesiredNumberScheduled:
+		state.State = model.StateReady
+	case status.NumberReady > 0:
+		state.State, state.Reason = model.StateDegraded, "MinimumReplicasUnavailable"
+		state.Message = fmt.Sprintf("%d of %d pods are ready", status.NumberReady, status.DesiredNumberScheduled)
+	default:
+		state.State, state.Reason = model.StateFailed, "NoReadyReplicas"
+		state.Message = fmt.Sprintf("0 of %d pods are ready", status.DesiredNumberScheduled)
+	}
+	return state
+}
+
+// JobState derives the state of a job from its completion and failure conditions
+func JobState(job *batchv1.Job, pods []*corev1.Pod) model.InstanceState {
+	completions := int32(1)
+	if job.Spec.Completions != nil {
+		completions = *job.Spec.Completions
+	}
+	state := model.InstanceState{
+		Type:            model.TypeJob,
+		Name:            job.Name,
+		BlockID:         job.GetObjectMeta().GetLabels()["kapeta.com/block-id"],
+		ReadyReplicas:   job.Status.Succeeded,
+		DesiredReplicas: completions,
+		Metadata:        map[string]string{},
+	}
+	if job.Status.StartTime != nil {
+		state.Metadata["startTime"] = job.Status.StartTime.Format(time.RFC3339)
+	}
+	if job.Status.CompletionTime != nil {
+		state.Metadata["completionTime"] = job.Status.CompletionTime.Format(time.RFC3339)
+	}
+	state.State, state.Reason, state.Message = jobState(job, completions, pods)
+	return state
+}
+
+func jobState(job *batchv1.Job, completions int32, pods []*corev1.Pod) (string, string, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return model.StateCompleted, "", ""
+		case batchv1.JobFailed:
+			return model.StateFailed, condition.Reason, condition.Message
+		case batchv1.JobSuspended:
+			return model.StateSuspended, condition.Reason, condition.Message
+		}
+	}
+	if state, reason, message := podProblem(pods); state != "" {
+		return state, reason, message
+	}
+	if job.Status.Active > 0 {
+		message := fmt.Sprintf("%d of %d completions, %d active pods", job.Status.Succeeded, completions, job.Status.Active)
+		if job.Status.Failed > 0 {
+			message += fmt.Sprintf(", %d failed attempts", job.Status.Failed)
+		}
+		return model.StateRunning, "Active", message
+	}
+	if reason, message, pending := pendingReason(pods); pending {
+		return model.StatePending, reason, message
+	}
+	return model.StatePending, "NotStarted", "the job has not started yet"
+}
+
+// CronJobState derives the state of a cronjob from its schedule and the outcome of its latest job
+func CronJobState(cronJob *batchv1.CronJob, jobs []*batchv1.Job) model.InstanceState {
+	state := model.InstanceState{
+		Type:     model.TypeCronJob,
+		Name:     cronJob.Name,
+		BlockID:  cronJob.GetObjectMeta().GetLabels()["kapeta.com/block-id"],
+		Metadata: map[string]string{"schedule": cronJob.Spec.Schedule},
+	}
+	status := cronJob.Status
+	if status.LastScheduleTime != nil {
+		state.Metadata["lastScheduleTime"] = status.LastScheduleTime.Format(time.RFC3339)
+	}
+	if status.LastSuccessfulTime != nil {
+		state.Metadata["lastSuccessfulTime"] = status.LastSuccessfulTime.Format(time.RFC3339)
+	}
+	state.ReadyReplicas = int32(len(status.Active))
+
+	latest := latestJob(cronJob, jobs)
+	switch {
+	case cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend:
+		state.State, state.Reason, state.Message = model.StateSuspended, "Suspended", "the cronjob is suspended"
+	case len(status.Active) > 0:
+		state.State, state.Reason = model.StateRunning, "Active"
+		state.Message = fmt.Sprintf("%d jobs are running", len(status.Active))
+	case latest != nil:
+		jobState := JobState(latest, nil)
+		switch jobState.State {
+		case model.StateCompleted:
+			state.State = model.StateReady
+		case model.StateFailed:
+			state.State, state.Reason = model.StateFailed, jobState.Reason
+			state.Message = fmt.Sprintf("the last run %v failed: %v", latest.Name, jobState.Message)
+		default:
+			state.State, state.Reason, state.Message = jobState.State, jobState.Reason, jobState.Message
+		}
+	case status.LastScheduleTime == nil:
+		state.State, state.Reason, state.Message = model.StatePending, "NotScheduledYet", "the cronjob has not been scheduled yet"
+	case status.LastSuccessfulTime == nil || status.LastSuccessfulTime.Before(status.LastScheduleTime):
+		state.State, state.Reason, state.Message = model.StateFailed, "LastRunFailed", "the last scheduled run did not succeed"
+	default:
+		state.State = model.StateReady
+	}
+	return state
+}
+
+// latestJob returns the most recently created job owned by the cronjob
+func latestJob(cronJob *batchv1.CronJob, jobs []*batchv1.Job) *batchv1.Job {
+	var latest *batchv1.Job
+	for _, job := range jobs {
+		if !isOwnedBy(job, cronJob.UID) {
+			continue
+		}
+		if latest == nil || job.CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = job
+		}
+	}
+	return latest
+}
+
+func isOwnedBy(obj metav1.Object, uid types.UID) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOwnerKind returns true if the object is owned by an object of the kind, e.g. a job created by a cronjob
+func HasOwnerKind(obj metav1.Object, kind string) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapetacom/insight-api/model"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStatefulSetState(t *testing.T) {
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Labels: map[string]string{"kapeta.com/block-id": "block-1"}},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 1, CurrentRevision: "a", UpdateRevision: "a"},
+	}
+	state := StatefulSetState(sts, nil)
+	assert.Equal(t, model.TypeStatefulSet, state.Type)
+	assert.Equal(t, model.StateProgressing, state.State)
+	assert.Equal(t, "OrderedReady", state.Reason)
+
+	sts.Status.Replicas = 3
+	sts.Status.ReadyReplicas = 3
+	assert.Equal(t, model.StateReady, StatefulSetState(sts, nil).State)
+}
+
+func TestJobState(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "migrate"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+			Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded",
+		}}},
+	}
+	state := JobState(job, nil)
+	assert.Equal(t, model.TypeJob, state.Type)
+	assert.Equal(t, model.StateFailed, state.State)
+	assert.Equal(t, "BackoffLimitExceeded", state.Reason)
+
+	job.Status = batchv1.JobStatus{Active: 1}
+	assert.Equal(t, model.StateRunning, JobState(job, nil).State)
+
+	job.Status = batchv1.JobStatus{Succeeded: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}}
+	assert.Equal(t, model.StateCompleted, JobState(job, nil).State)
+}
+
+func TestCronJobState(t *testing.T) {
+	now := time.Now()
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "cleanup", UID: "cron-uid"},
+		Spec:       batchv1.CronJobSpec{Schedule: "*/5 * * * *"},
+	}
+	state := CronJobState(cronJob, nil)
+	assert.Equal(t, model.StatePending, state.State)
+	assert.Equal(t, "NotScheduledYet", state.Reason)
+
+	cronJob.Status.LastScheduleTime = &metav1.Time{Time: now}
+	cronJob.Status.LastSuccessfulTime = &metav1.Time{Time: now.Add(-time.Hour)}
+	jobs := []*batchv1.Job{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "cleanup-1", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)), OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", UID: "cron-uid"}}},
+			Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "cleanup-2", CreationTimestamp: metav1.NewTime(now), OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", UID: "cron-uid"}}},
+			Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}}},
+		},
+	}
+	state = CronJobState(cronJob, jobs)
+	assert.Equal(t, model.StateFailed, state.State)
+	assert.Equal(t, "DeadlineExceeded", state.Reason)
+	assert.Equal(t, now.Format(time.RFC3339), state.Metadata["lastScheduleTime"])
+
+	state = CronJobState(cronJob, jobs[:1])
+	assert.Equal(t, model.StateReady, state.State)
+}